@@ -0,0 +1,215 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Component is a named part of the service with its own handlers, e.g. HTTP
+// server or queue consumer. Components are registered with WithComponent,
+// started in dependency order and stopped in reverse order.
+type Component struct {
+	// Name of component, unique within the service
+	Name string
+	// DependsOn is a list of names of components which must be started
+	// before this one
+	DependsOn []string
+	// StartHdlr is non-blocking start component handler
+	StartHdlr func() error
+	// StopHdlr is non-blocking stop component handler
+	StopHdlr func() error
+	// ReloadHdlr is non-blocking reload component handler
+	ReloadHdlr func() error
+	// RunContext is blocking component function started after StartHdlr.
+	// The ctx is cancelled on stop. Failure of RunContext stops the service
+	// or, if Config.RestartPolicy is set, restarts the function.
+	RunContext func(ctx context.Context) error
+}
+
+// Started component with its running RunContext
+type startedComponent struct {
+	Component
+	cancel context.CancelFunc
+	done   <-chan error
+}
+
+// Started components of the service, they are stopped in reverse order
+type components struct {
+	config  *Config
+	started []startedComponent
+	failed  chan error
+}
+
+// Return channel of fatal component failures, nil if there are no
+// components
+func (g *components) failures() <-chan error {
+	if g == nil {
+		return nil
+	}
+	return g.failed
+}
+
+// Set service handlers managing components. Handlers specified explicitly
+// can not be combined with components.
+func (c *Config) wireComponents() error {
+	if len(c.Components) == 0 || c.components != nil {
+		return nil
+	}
+	var reload bool
+	for _, comp := range c.Components {
+		reload = reload || comp.ReloadHdlr != nil
+	}
+	if c.StartHdlr != nil || c.StopHdlr != nil || reload && c.ReloadHdlr != nil {
+		return ErrComponentsWithHandlers
+	}
+	c.components = &components{config: c, failed: make(chan error, 1)}
+	c.StartHdlr, c.StopHdlr = c.components.start, c.components.stop
+	if reload {
+		c.ReloadHdlr = c.components.reload
+	}
+	return nil
+}
+
+// Sort components in dependency order. Components without dependencies
+// between them keep the registration order.
+func sortComponents(list []Component) ([]Component, error) {
+	var (
+		byName  = make(map[string]Component, len(list))
+		visited = make(map[string]int, len(list))
+		sorted  = make([]Component, 0, len(list))
+		visit   func(comp Component, path []string) error
+	)
+	for _, comp := range list {
+		if comp.Name == "" {
+			return nil, fmt.Errorf("%w: empty component name", ErrComponentDependency)
+		}
+		if _, ok := byName[comp.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate component %q", ErrComponentDependency, comp.Name)
+		}
+		byName[comp.Name] = comp
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	visit = func(comp Component, path []string) error {
+		switch visited[comp.Name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: dependency cycle %s", ErrComponentDependency,
+				strings.Join(append(path, comp.Name), " -> "))
+		}
+		visited[comp.Name] = visiting
+		for _, name := range comp.DependsOn {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("%w: component %q depends on unknown %q", ErrComponentDependency, comp.Name, name)
+			}
+			if err := visit(dep, append(path, comp.Name)); err != nil {
+				return err
+			}
+		}
+		visited[comp.Name] = done
+		sorted = append(sorted, comp)
+		return nil
+	}
+	for _, comp := range list {
+		if err := visit(comp, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// Start components in dependency order. Failure of any component stops the
+// already started ones.
+func (g *components) start() error {
+	sorted, err := sortComponents(g.config.Components)
+	if err != nil {
+		return err
+	}
+	for _, comp := range sorted {
+		if comp.StartHdlr != nil {
+			if err = comp.StartHdlr(); err != nil {
+				g.config.logger().Error("component start failed", "component", comp.Name, "error", err)
+				if stopErr := g.stop(); stopErr != nil {
+					g.config.logger().Error("rollback failed", "error", stopErr)
+				}
+				return fmt.Errorf("start %s component: %w", comp.Name, err)
+			}
+		}
+		g.started = append(g.started, g.run(comp))
+		g.config.logger().Debug("component started", "component", comp.Name)
+	}
+	return nil
+}
+
+// Start supervised RunContext of component if any
+func (g *components) run(comp Component) startedComponent {
+	started := startedComponent{Component: comp}
+	if comp.RunContext == nil {
+		return started
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		err := g.config.supervise(ctx, comp.Name, comp.RunContext)
+		if err != nil && ctx.Err() == nil {
+			// failure is reported to the run loop, not to stop
+			select {
+			case g.failed <- err:
+			default:
+			}
+			err = nil
+		}
+		done <- err
+	}()
+	started.cancel, started.done = cancel, done
+	return started
+}
+
+// Stop started components in reverse order. All of them are stopped even if
+// some fail, the first error is returned.
+func (g *components) stop() (err error) {
+	for i := len(g.started) - 1; i >= 0; i-- {
+		comp := g.started[i]
+		var stopErr error
+		if comp.cancel != nil {
+			comp.cancel()
+		}
+		if comp.StopHdlr != nil {
+			stopErr = comp.StopHdlr()
+		}
+		if comp.done != nil {
+			if runErr := <-comp.done; stopErr == nil && !errors.Is(runErr, context.Canceled) {
+				stopErr = runErr
+			}
+		}
+		if stopErr != nil {
+			g.config.logger().Error("component stop failed", "component", comp.Name, "error", stopErr)
+			if err == nil {
+				err = fmt.Errorf("stop %s component: %w", comp.Name, stopErr)
+			}
+			continue
+		}
+		g.config.logger().Debug("component stopped", "component", comp.Name)
+	}
+	g.started = nil
+	return err
+}
+
+// Reload started components in dependency order
+func (g *components) reload() error {
+	for _, comp := range g.started {
+		if comp.ReloadHdlr == nil {
+			continue
+		}
+		if err := comp.ReloadHdlr(); err != nil {
+			return fmt.Errorf("reload %s component: %w", comp.Name, err)
+		}
+	}
+	return nil
+}
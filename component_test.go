@@ -0,0 +1,180 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSortComponents(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []Component
+		want       []string
+		err        bool
+	}{
+		{
+			name: "registration order",
+			components: []Component{
+				{Name: "a"}, {Name: "b"}, {Name: "c"},
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "dependencies first",
+			components: []Component{
+				{Name: "http", DependsOn: []string{"cache", "db"}},
+				{Name: "db"},
+				{Name: "cache", DependsOn: []string{"db"}},
+				{Name: "queue"},
+			},
+			want: []string{"db", "cache", "http", "queue"},
+		},
+		{
+			name: "cycle",
+			components: []Component{
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b", DependsOn: []string{"a"}},
+			},
+			err: true,
+		},
+		{
+			name:       "unknown dependency",
+			components: []Component{{Name: "a", DependsOn: []string{"x"}}},
+			err:        true,
+		},
+		{
+			name:       "duplicate",
+			components: []Component{{Name: "a"}, {Name: "a"}},
+			err:        true,
+		},
+		{
+			name:       "empty name",
+			components: []Component{{}},
+			err:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortComponents(tt.components)
+			if tt.err {
+				if !errors.Is(err, ErrComponentDependency) {
+					t.Fatalf("sortComponents() error = %v, want ErrComponentDependency", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sortComponents() error = %v", err)
+			}
+			var names []string
+			for _, comp := range sorted {
+				names = append(names, comp.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("sortComponents() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentsStartRollback(t *testing.T) {
+	var calls []string
+	comp := func(name string, err error, deps ...string) ConfigOption {
+		return WithComponent(Component{
+			Name:      name,
+			DependsOn: deps,
+			StartHdlr: func() error {
+				calls = append(calls, "start "+name)
+				return err
+			},
+			StopHdlr: func() error {
+				calls = append(calls, "stop "+name)
+				return nil
+			},
+		})
+	}
+	c := NewConfig(
+		WithLogger(nopLogger{}),
+		comp("http", errors.New("boom"), "cache"),
+		comp("db", nil),
+		comp("cache", nil, "db"),
+	)
+	if err := c.check(); err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if err := c.StartHdlr(); err == nil {
+		t.Fatal("StartHdlr() error = nil, want start failure")
+	}
+	want := []string{"start db", "start cache", "start http", "stop cache", "stop db"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestComponentsHandlers(t *testing.T) {
+	hdlr := func() error { return nil }
+	comp := Component{Name: "a", StartHdlr: hdlr, ReloadHdlr: hdlr}
+	tests := []struct {
+		name string
+		opts []ConfigOption
+		err  error
+	}{
+		{
+			name: "option",
+			opts: []ConfigOption{WithComponent(comp)},
+		},
+		{
+			name: "field",
+			opts: []ConfigOption{func(c *Config) { c.Components = []Component{comp} }},
+		},
+		{
+			name: "start handler after component",
+			opts: []ConfigOption{WithComponent(comp), WithStartHdlr(hdlr)},
+			err:  ErrComponentsWithHandlers,
+		},
+		{
+			name: "stop handler before component",
+			opts: []ConfigOption{WithStopHdlr(hdlr), WithComponent(comp)},
+			err:  ErrComponentsWithHandlers,
+		},
+		{
+			name: "reload handler",
+			opts: []ConfigOption{WithReloadHdlr(hdlr), WithComponent(comp)},
+			err:  ErrComponentsWithHandlers,
+		},
+		{
+			name: "reload handler of service",
+			opts: []ConfigOption{WithReloadHdlr(hdlr), WithComponent(Component{Name: "a"})},
+		},
+		{
+			name: "run context",
+			opts: []ConfigOption{WithRunContext(func(ctx context.Context) error { return nil }), WithComponent(comp)},
+			err:  ErrComponentsWithRunContext,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig(append([]ConfigOption{WithLogger(nopLogger{}), WithHideMethodsWarning(true)}, tt.opts...)...)
+			if err := c.check(); !errors.Is(err, tt.err) {
+				t.Fatalf("check() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if c.StartHdlr == nil || c.StopHdlr == nil || c.ReloadHdlr == nil {
+				t.Fatal("check() did not set handlers of components")
+			}
+			// config may be checked by several New calls
+			if err := c.check(); err != nil {
+				t.Fatalf("second check() error = %v", err)
+			}
+			if err := c.StartHdlr(); err != nil {
+				t.Fatalf("StartHdlr() error = %v", err)
+			}
+			if err := c.StopHdlr(); err != nil {
+				t.Fatalf("StopHdlr() error = %v", err)
+			}
+		})
+	}
+}
@@ -1,5 +1,12 @@
 package daemon
 
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
 // Config type
 type Config struct {
 	// Name of daemon
@@ -11,7 +18,9 @@ type Config struct {
 
 	// PIDDir is path to the directory containing the pid file.
 	// Default value is "/run".
-	// Suitable for for SystemV only
+	// Suitable for for SystemV only. On Linux the running service also
+	// marks its paused state here (in XDG_RUNTIME_DIR in systemd user
+	// scope), so it must be writable by the service, see PauseSignal.
 	PIDDir string
 	// PIDName is empty by default.
 	// In this case, Name will be used instead of PIDName
@@ -25,12 +34,44 @@ type Config struct {
 	// Suitable for for Linux SystemV and UpStart only
 	StopRunLevels []int
 
+	// SystemDTemplateUnit installs the service as template unit
+	// "Name@.service". Instances of the unit are managed with
+	// Daemon.Instance. Specifier %i in template and args is replaced with
+	// instance name by systemd.
+	// Suitable for Linux SystemD only
+	SystemDTemplateUnit bool
+
+	// SystemDUserScope installs the service as user service to
+	// ~/.config/systemd/user managed with `systemctl --user`. Root
+	// privileges are not required in this scope, PrivilegesCheck is still
+	// called if set. New fails if neither XDG_CONFIG_HOME nor HOME is set.
+	// Suitable for Linux SystemD only
+	SystemDUserScope bool
+	// SystemDLinger enables lingering of the user on install, so user
+	// services are started at boot and are kept running after logout.
+	// Lingering is not disabled on uninstall as other services of the user
+	// may rely on it.
+	// Suitable for Linux SystemD in user scope only
+	SystemDLinger bool
+
+	// InitSystem forces init system used to manage the service. It is
+	// detected with DetectInitSystem by default.
+	InitSystem InitSystem
+
+	// RootDir is an alternate root directory. If set, service files are
+	// installed to and removed from RootDir instead of "/", e.g. while
+	// building OS images or containers. Not suitable for Windows.
+	RootDir string
+
 	// TemplateLinuxUpstart contains template for Linux UpStart service file
 	TemplateLinuxUpstart string
 	// TemplateLinuxSystemV contains template for Linux SystemV service file
 	TemplateLinuxSystemV string
 	// TemplateLinuxSystemD contains template for Linux SystemD service unit
 	TemplateLinuxSystemD string
+	// TemplateLinuxSystemDInstance contains template for Linux SystemD
+	// drop-in file of template unit instance
+	TemplateLinuxSystemDInstance string
 	// TemplateMacOSPorpertyList contains template for MacOS property list
 	TemplateMacOSPorpertyList string
 	// TemplateFreeBSDSystemV contains template for FreeBSD SystemV system
@@ -50,6 +91,24 @@ type Config struct {
 	// https://godoc.org/golang.org/x/sys/windows/svc/mgr#Config
 	WindowsStartAccountPassword string
 
+	// PreHooks are run before the operation, error of a hook aborts it.
+	// Hooks are supported for Install, Uninstall, Start, Stop, Restart and
+	// Reload.
+	PreHooks map[Operation][]Hook
+	// PostHooks are run after successful operation. Error of a hook reverts
+	// Install, Start and Stop; other operations can not be reverted.
+	PostHooks map[Operation][]Hook
+
+	// PrivilegesCheck checks rights to perform the operation. By default
+	// effective user must be root or have capabilities to manage services
+	// if Operation.RequiresPrivileges. Override it in tests, see daemontest.
+	// Not suitable for Windows.
+	PrivilegesCheck func(op Operation) error
+
+	// Executor runs external commands such as systemctl. Commands are run
+	// with os/exec if Executor is nil.
+	Executor Executor
+
 	// StartHdlr is non-blocking start service handler
 	StartHdlr func() error
 	// StopHdlr is non-blocking stop service handler
@@ -64,6 +123,67 @@ type Config struct {
 	// Daemon will ignore other handlers if this setted.
 	// Not suitable for Windows services.
 	RunHdlr func() error
+	// RunContext is blocking alternative to StartHdlr and StopHdlr. The
+	// ctx is cancelled on termination signal (or Windows stop request) and
+	// Run waits for RunContext to return. Its error is returned by Run.
+	// StartHdlr and StopHdlr are ignored if this setted. It can not be
+	// used with Components.
+	RunContext func(ctx context.Context) error
+	// ReloadContext is reload service handler used with RunContext, the ctx
+	// is the one passed to RunContext. ReloadHdlr is used if it is nil.
+	// Not suitable for Windows services.
+	ReloadContext func(ctx context.Context) error
+
+	// Components are parts of the service started in dependency order and
+	// stopped in reverse order. New sets StartHdlr, StopHdlr and, if any
+	// component has ReloadHdlr, ReloadHdlr to manage components, so they
+	// can not be specified along with components.
+	Components []Component
+	// components tracks started components
+	components *components
+
+	// RestartPolicy enables in-process supervisor which restarts failed
+	// RunContext and component RunContext, see RestartPolicy
+	RestartPolicy *RestartPolicy
+
+	// CrashReportDir is a directory for crash reports written on panic or
+	// failure of the service, reports are not written if it is empty. Use
+	// LastCrashReport to get the latest one.
+	CrashReportDir string
+	// CrashReportLimit is a number of kept crash reports, 10 by default
+	CrashReportLimit int
+
+	// PauseSignal and ContinueSignal are sent by Pause and Continue to the
+	// running service, which calls PauseHdlr and ContinueHdlr. They are
+	// SIGUSR1 and SIGUSR2 by default and handled only if both handlers
+	// are set. Not suitable for Windows services.
+	PauseSignal    os.Signal
+	ContinueSignal os.Signal
+
+	// SignalActions overrides actions of the run loop on signals. By default
+	// SIGINT, SIGTERM, SIGQUIT and SIGTSTP stop the service, SIGHUP
+	// reloads it if reload handler is set and PauseSignal and
+	// ContinueSignal pause and continue it. Use WithSignalAction to set.
+	// Not suitable for Windows services.
+	SignalActions map[os.Signal]SignalAction
+
+	// Logger receives messages of the package. Messages are written to
+	// ErrorHdlr and InfoHdlr if Logger is nil.
+	Logger Logger
+	// lifecycle is a state of the process driven by the run loop, it is
+	// created by NewConfig
+	lifecycle *lifecycle
+
+	// StartTimeout limits StartHdlr run time, zero means no limit. Process
+	// dumps goroutine stacks and exits with ExitCodeHandlerTimeout if
+	// handler hangs.
+	StartTimeout time.Duration
+	// StopTimeout limits StopHdlr run time, zero means no limit. Second
+	// termination signal received while StopHdlr is running forces exit
+	// with ExitCodeForcedShutdown.
+	StopTimeout time.Duration
+	// ReloadTimeout limits ReloadHdlr run time, zero means no limit
+	ReloadTimeout time.Duration
 
 	// ErrorHdlr is non-blocking error message handler
 	ErrorHdlr func(format string, args ...interface{})
@@ -71,16 +191,40 @@ type Config struct {
 	InfoHdlr func(format string, args ...interface{})
 }
 
+func (c *Config) executor() Executor {
+	if c.Executor == nil {
+		return defaultExecutor
+	}
+	return c.Executor
+}
+
+// Get path of the system file relative to RootDir
+func (c *Config) rootPath(path string) string {
+	if c.RootDir == "" {
+		return path
+	}
+	return filepath.Join(c.RootDir, path)
+}
+
 func (c *Config) check() error {
 	if c == nil {
 		return ErrConfigNotSpecified
 	}
-	if c.ErrorHdlr == nil {
+	if c.Logger == nil && c.ErrorHdlr == nil {
 		return ErrMethodErrorNotSpecified
 	}
-	if c.InfoHdlr == nil {
+	if c.Logger == nil && c.InfoHdlr == nil {
 		return ErrMethodInfoNotSpecified
 	}
+	if _, err := sortComponents(c.Components); err != nil {
+		return err
+	}
+	if c.RunContext != nil && len(c.Components) > 0 {
+		return ErrComponentsWithRunContext
+	}
+	if err := c.wireComponents(); err != nil {
+		return err
+	}
 	var info []string
 	if c.PauseHdlr == nil {
 		info = append(info, "Pause")
@@ -88,13 +232,16 @@ func (c *Config) check() error {
 	if c.ContinueHdlr == nil {
 		info = append(info, "Continue")
 	}
-	if c.ReloadHdlr == nil {
+	if c.ReloadHdlr == nil && c.ReloadContext == nil {
 		info = append(info, "Reload")
 	}
 	if len(info) > 0 && !c.HideMethodsWarning {
-		c.InfoHdlr("%v: %s", ErrSomeMethodsNotSpecified, info)
+		c.logger().Warn(ErrSomeMethodsNotSpecified.Error(), "methods", info)
 	}
 	var err []string
+	if c.RunContext != nil {
+		return nil
+	}
 	if c.StartHdlr == nil {
 		err = append(err, "Start")
 	}
@@ -102,7 +249,7 @@ func (c *Config) check() error {
 		err = append(err, "Stop")
 	}
 	if len(err) > 0 && !c.HideMethodsWarning {
-		c.ErrorHdlr("%v: %s", ErrSomeMethodsNotSpecified, err)
+		c.logger().Error(ErrSomeMethodsNotSpecified.Error(), "methods", err)
 		return ErrSomeMethodsNotSpecified
 	}
 	return nil
@@ -1,5 +1,11 @@
 package daemon
 
+import (
+	"context"
+	"os"
+	"time"
+)
+
 type ConfigOption func(*Config)
 
 func WithName(name string) ConfigOption {
@@ -44,6 +50,18 @@ func WithStopRunLevels(lvls ...int) ConfigOption {
 	}
 }
 
+func WithInitSystem(system InitSystem) ConfigOption {
+	return func(c *Config) {
+		c.InitSystem = system
+	}
+}
+
+func WithRootDir(dir string) ConfigOption {
+	return func(c *Config) {
+		c.RootDir = dir
+	}
+}
+
 func WithTemplateLinuxUpstart(template string) ConfigOption {
 	return func(c *Config) {
 		c.TemplateLinuxUpstart = template
@@ -62,6 +80,12 @@ func WithTemplateLinuxSystemD(template string) ConfigOption {
 	}
 }
 
+func WithTemplateLinuxSystemDInstance(template string) ConfigOption {
+	return func(c *Config) {
+		c.TemplateLinuxSystemDInstance = template
+	}
+}
+
 func WithTemplateMacOSPorpertyList(template string) ConfigOption {
 	return func(c *Config) {
 		c.TemplateMacOSPorpertyList = template
@@ -74,6 +98,24 @@ func WithTemplateFreeBSDSystemV(template string) ConfigOption {
 	}
 }
 
+func WithSystemDTemplateUnit(templateUnit bool) ConfigOption {
+	return func(c *Config) {
+		c.SystemDTemplateUnit = templateUnit
+	}
+}
+
+func WithSystemDUserScope(userScope bool) ConfigOption {
+	return func(c *Config) {
+		c.SystemDUserScope = userScope
+	}
+}
+
+func WithSystemDLinger(linger bool) ConfigOption {
+	return func(c *Config) {
+		c.SystemDLinger = linger
+	}
+}
+
 func WithHideMethodsWarning(hideMethodsWarning bool) ConfigOption {
 	return func(c *Config) {
 		c.HideMethodsWarning = hideMethodsWarning
@@ -98,6 +140,36 @@ func WithWindowsStartAccountPassword(password string) ConfigOption {
 	}
 }
 
+func WithPreHook(op Operation, hook Hook) ConfigOption {
+	return func(c *Config) {
+		if c.PreHooks == nil {
+			c.PreHooks = make(map[Operation][]Hook)
+		}
+		c.PreHooks[op] = append(c.PreHooks[op], hook)
+	}
+}
+
+func WithPostHook(op Operation, hook Hook) ConfigOption {
+	return func(c *Config) {
+		if c.PostHooks == nil {
+			c.PostHooks = make(map[Operation][]Hook)
+		}
+		c.PostHooks[op] = append(c.PostHooks[op], hook)
+	}
+}
+
+func WithPrivilegesCheck(check func(op Operation) error) ConfigOption {
+	return func(c *Config) {
+		c.PrivilegesCheck = check
+	}
+}
+
+func WithExecutor(executor Executor) ConfigOption {
+	return func(c *Config) {
+		c.Executor = executor
+	}
+}
+
 func WithStartHdlr(hdlr func() error) ConfigOption {
 	return func(c *Config) {
 		c.StartHdlr = hdlr
@@ -134,6 +206,82 @@ func WithRunHdlr(hdlr func() error) ConfigOption {
 	}
 }
 
+func WithLogger(logger Logger) ConfigOption {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
+func WithStartTimeout(timeout time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.StartTimeout = timeout
+	}
+}
+
+func WithStopTimeout(timeout time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.StopTimeout = timeout
+	}
+}
+
+func WithReloadTimeout(timeout time.Duration) ConfigOption {
+	return func(c *Config) {
+		c.ReloadTimeout = timeout
+	}
+}
+
+func WithRunContext(hdlr func(ctx context.Context) error) ConfigOption {
+	return func(c *Config) {
+		c.RunContext = hdlr
+	}
+}
+
+func WithReloadContext(hdlr func(ctx context.Context) error) ConfigOption {
+	return func(c *Config) {
+		c.ReloadContext = hdlr
+	}
+}
+
+func WithComponent(comp Component) ConfigOption {
+	return func(c *Config) {
+		c.Components = append(c.Components, comp)
+	}
+}
+
+func WithRestartPolicy(policy RestartPolicy) ConfigOption {
+	return func(c *Config) {
+		c.RestartPolicy = &policy
+	}
+}
+
+func WithCrashReportDir(dir string) ConfigOption {
+	return func(c *Config) {
+		c.CrashReportDir = dir
+	}
+}
+
+func WithCrashReportLimit(limit int) ConfigOption {
+	return func(c *Config) {
+		c.CrashReportLimit = limit
+	}
+}
+
+func WithPauseSignals(pause, resume os.Signal) ConfigOption {
+	return func(c *Config) {
+		c.PauseSignal = pause
+		c.ContinueSignal = resume
+	}
+}
+
+func WithSignalAction(sig os.Signal, action SignalAction) ConfigOption {
+	return func(c *Config) {
+		if c.SignalActions == nil {
+			c.SignalActions = make(map[os.Signal]SignalAction)
+		}
+		c.SignalActions[sig] = action
+	}
+}
+
 func WithErrorHdlr(hdlr func(format string, args ...interface{})) ConfigOption {
 	return func(c *Config) {
 		c.ErrorHdlr = hdlr
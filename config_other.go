@@ -4,9 +4,12 @@
 package daemon
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/debug"
 	"syscall"
 )
@@ -15,14 +18,20 @@ import (
 // Fills the generated Config with default templates.
 func NewConfig(opts ...ConfigOption) *Config {
 	cfg := &Config{
-		TemplateFreeBSDSystemV:    defaultTemplateFreeBSDSystemV,
-		TemplateLinuxSystemD:      defaultTemplateLinuxSystemD,
-		TemplateLinuxSystemV:      defaultTemplateLinuxSystemV,
-		TemplateLinuxUpstart:      defaultTemplateLinuxUpstart,
-		TemplateMacOSPorpertyList: defaultTemplateMacOSPorpertyList,
+		TemplateFreeBSDSystemV:       defaultTemplateFreeBSDSystemV,
+		TemplateLinuxSystemD:         defaultTemplateLinuxSystemD,
+		TemplateLinuxSystemDInstance: defaultTemplateLinuxSystemDInstance,
+		TemplateLinuxSystemV:         defaultTemplateLinuxSystemV,
+		TemplateLinuxUpstart:         defaultTemplateLinuxUpstart,
+		TemplateMacOSPorpertyList:    defaultTemplateMacOSPorpertyList,
 
 		PIDDir: "/run",
 
+		PauseSignal:    syscall.SIGUSR1,
+		ContinueSignal: syscall.SIGUSR2,
+
+		lifecycle: &lifecycle{},
+
 		StartRunLevels: []int{2, 3, 4, 5},
 		StopRunLevels:  []int{0, 1, 6},
 
@@ -46,47 +55,90 @@ func NewConfig(opts ...ConfigOption) *Config {
 // It is using StartHdlr, StopHdlr and ReloadHdlr.
 func defaultRunHdlr(c *Config) func() error {
 	return func() (err error) {
-		// signal.Ignore(syscall.SIGTSTP)
 		var (
 			sigChan  = make(chan os.Signal, 1)
 			exitChan = make(chan int)
-			signals  = []os.Signal{
-				syscall.SIGINT,
-				syscall.SIGTERM,
-				syscall.SIGQUIT,
-				syscall.SIGTSTP,
-			}
 		)
-		if c.ReloadHdlr != nil {
-			signals = append(signals, syscall.SIGHUP)
+		c.notifySignals(sigChan)
+		if c.RunContext != nil {
+			return serveContext(c, sigChan)
 		}
-		signal.Notify(sigChan, signals...)
 		go func(ch <-chan os.Signal) {
 			defer func() {
 				str := recover()
 				if str != nil {
 					str = fmt.Sprintf("%s; %s", str, string(debug.Stack()))
-					err = fmt.Errorf("run() panic: %s", str)
-					exitChan <- 100
+					err = &ExitError{Code: ExitCodePanic, Err: fmt.Errorf("run() panic: %s", str)}
+					c.fail(err)
+					exitChan <- ExitCodePanic
 				}
 			}()
-			if err = c.StartHdlr(); err != nil {
-				exitChan <- 1
+			c.lifecycle.set(LifecycleStarting, nil)
+			if err = c.callHdlr("start", c.StartHdlr, c.StartTimeout, nil); err != nil {
+				c.logger().Error("start failed", "pid", os.Getpid(), "error", err)
+				err = exitError(ExitCodeStartFailed, err)
+				c.fail(err)
+				exitChan <- ExitCode(err)
+				return
 			}
+			c.logger().Info("service started", "pid", os.Getpid())
+			c.lifecycle.set(LifecycleRunning, nil)
 			for {
-				sig := <-ch
-				sigName, sigDesc := sigNameDesc(sig)
-				c.InfoHdlr("SIGNAL %s catched (%s)", sigName, sigDesc)
-				if sigName == "reload" {
-					if err = c.ReloadHdlr(); err != nil {
-						exitChan <- 1
+				var sig os.Signal
+				select {
+				case sig = <-ch:
+				case err = <-c.components.failures():
+					c.logger().Error("component failed", "pid", os.Getpid(), "error", err)
+					c.lifecycle.set(LifecycleStopping, nil)
+					if stopErr := c.callHdlr("stop", c.StopHdlr, c.StopTimeout, ch); stopErr != nil {
+						c.logger().Error("stop failed", "pid", os.Getpid(), "error", stopErr)
 					}
-				} else {
-					if err = c.StopHdlr(); err != nil {
-						exitChan <- 1
+					c.fail(err)
+					exitChan <- ExitCode(err)
+					return
+				}
+				action := c.logSignal(sig)
+				switch {
+				case action.is(SignalReload) && c.ReloadHdlr == nil:
+					c.logger().Warn("reload handler is not specified", "signal", sig.String())
+					continue
+				case action.is(SignalReload):
+					c.lifecycle.set(LifecycleReloading, nil)
+					if err = c.callHdlr("reload", c.ReloadHdlr, c.ReloadTimeout, nil); err != nil {
+						c.logger().Error("reload failed", "pid", os.Getpid(), "error", err)
+						err = exitError(ExitCodeReloadFailed, err)
+						c.fail(err)
+						exitChan <- ExitCode(err)
+						return
+					}
+					c.lifecycle.set(LifecycleRunning, nil)
+					continue
+				case action.is(SignalPause), action.is(SignalContinue):
+					if err = c.pauseOrContinue(action); err != nil {
+						_ = c.setPaused(false)
+						c.lifecycle.set(LifecycleStopping, nil)
+						if stopErr := c.callHdlr("stop", c.StopHdlr, c.StopTimeout, ch); stopErr != nil {
+							c.logger().Error("stop failed", "pid", os.Getpid(), "error", stopErr)
+						}
+						c.fail(err)
+						exitChan <- ExitCode(err)
+						return
 					}
-					exitChan <- 1
+					continue
+				case !action.is(SignalStop):
+					c.runSignalAction(sig, action)
+					continue
 				}
+				_ = c.setPaused(false)
+				c.lifecycle.set(LifecycleStopping, nil)
+				if err = c.callHdlr("stop", c.StopHdlr, c.StopTimeout, ch); err != nil {
+					c.logger().Error("stop failed", "pid", os.Getpid(), "error", err)
+					c.fail(err)
+				} else {
+					c.lifecycle.set(LifecycleStopped, nil)
+				}
+				exitChan <- ExitCode(err)
+				return
 			}
 		}(sigChan)
 		<-exitChan
@@ -94,18 +146,187 @@ func defaultRunHdlr(c *Config) func() error {
 	}
 }
 
-func sigNameDesc(sig os.Signal) (sigName, sigDesc string) {
+// Relay handled signals to ch and ignore the ones with SignalIgnore action
+func (c *Config) notifySignals(ch chan<- os.Signal) {
+	var signals []os.Signal
+	for sig, action := range c.signalActions() {
+		if action.is(SignalIgnore) {
+			signal.Ignore(sig)
+			continue
+		}
+		signals = append(signals, sig)
+	}
+	// Notify without signals relays all of them
+	if len(signals) > 0 {
+		signal.Notify(ch, signals...)
+	}
+}
+
+// Run RunContext until it returns or termination signal is received
+func serveContext(c *Config, ch <-chan os.Signal) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := c.runContext(ctx)
+	reload := c.ReloadHdlr
+	if c.ReloadContext != nil {
+		reload = func() error { return c.ReloadContext(ctx) }
+	}
+	for {
+		select {
+		case err := <-done:
+			return c.finishContext(err)
+		case sig := <-ch:
+			action := c.logSignal(sig)
+			switch {
+			case action.is(SignalStop):
+				_ = c.setPaused(false)
+				return c.finishContext(c.stopContext(cancel, done, ch))
+			case action.is(SignalPause), action.is(SignalContinue):
+				if err := c.pauseOrContinue(action); err != nil {
+					_ = c.setPaused(false)
+					_ = c.stopContext(cancel, done, ch)
+					c.fail(err)
+					return err
+				}
+				continue
+			case action.is(SignalReload) && reload == nil:
+				c.logger().Warn("reload handler is not specified", "signal", sig.String())
+				continue
+			case !action.is(SignalReload):
+				c.runSignalAction(sig, action)
+				continue
+			}
+			c.lifecycle.set(LifecycleReloading, nil)
+			if err := c.callHdlr("reload", reload, c.ReloadTimeout, nil); err != nil {
+				c.logger().Error("reload failed", "pid", os.Getpid(), "error", err)
+				err = exitError(ExitCodeReloadFailed, err)
+				_ = c.stopContext(cancel, done, ch)
+				c.fail(err)
+				return err
+			}
+			c.lifecycle.set(LifecycleRunning, nil)
+		}
+	}
+}
+
+// Default actions: SIGINT, SIGTERM, SIGQUIT and SIGTSTP stop the service,
+// SIGHUP reloads it if reload handler is set, PauseSignal and ContinueSignal
+// pause and continue it if pause and continue handlers are set
+func (c *Config) defaultSignalActions() map[os.Signal]SignalAction {
+	actions := map[os.Signal]SignalAction{
+		syscall.SIGINT:  SignalStop,
+		syscall.SIGTERM: SignalStop,
+		syscall.SIGQUIT: SignalStop,
+		syscall.SIGTSTP: SignalStop,
+	}
+	if c.ReloadHdlr != nil || c.ReloadContext != nil {
+		actions[syscall.SIGHUP] = SignalReload
+	}
+	if c.pausable() {
+		actions[c.PauseSignal] = SignalPause
+		actions[c.ContinueSignal] = SignalContinue
+	}
+	return actions
+}
+
+// Log received signal and return its action
+func (c *Config) logSignal(sig os.Signal) SignalAction {
+	action, _ := c.signalAction(sig)
+	c.logger().Info("signal received", "signal", sig.String(), "action", action.String(), "description", sigDesc(sig))
+	return action
+}
+
+// Pause or continue the service. Paused service marks its state with a
+// file in PIDDir after successful PauseHdlr, so Status of the management
+// side reports it. The marker is removed after successful ContinueHdlr.
+func (c *Config) pauseOrContinue(action SignalAction) error {
+	var (
+		pause  = action.is(SignalPause)
+		paused = c.lifecycle.get() == LifecyclePaused
+		name   = "continue"
+		hdlr   = c.ContinueHdlr
+		next   = LifecycleRunning
+	)
+	if pause {
+		name, hdlr, next = "pause", c.PauseHdlr, LifecyclePaused
+	}
+	if pause == paused || hdlr == nil {
+		c.logger().Warn("signal action skipped", "action", name, "state", c.lifecycle.get().String())
+		return nil
+	}
+	if err := c.callHdlr(name, hdlr, 0, nil); err != nil {
+		c.logger().Error(name+" failed", "pid", os.Getpid(), "error", err)
+		return err
+	}
+	if !pause {
+		_ = c.setPaused(false)
+	} else if c.setPaused(true) != nil {
+		// paused state must be visible to Status, so the service is
+		// continued if the marker can not be written
+		if err := c.callHdlr("continue", c.ContinueHdlr, 0, nil); err != nil {
+			c.logger().Error("continue failed", "pid", os.Getpid(), "error", err)
+			return err
+		}
+		return nil
+	}
+	c.lifecycle.set(next, nil)
+	return nil
+}
+
+// Check the service can be paused and continued with signals
+func (c *Config) pausable() bool {
+	return c.PauseHdlr != nil && c.ContinueHdlr != nil && c.PauseSignal != nil && c.ContinueSignal != nil
+}
+
+// Directory of runtime files of the service process: XDG_RUNTIME_DIR in
+// systemd user scope, PIDDir otherwise
+func (c *Config) runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); c.SystemDUserScope && dir != "" {
+		return dir
+	}
+	return c.PIDDir
+}
+
+// Path of the file marking paused service process
+func (c *Config) pausedFile(pid int) string {
+	name := c.PIDName
+	if name == "" {
+		name = c.Name
+	}
+	return filepath.Join(c.runtimeDir(), fmt.Sprintf("%s.%d.paused", name, pid))
+}
+
+// Create or remove paused marker of the process
+func (c *Config) setPaused(paused bool) error {
+	var (
+		path = c.pausedFile(os.Getpid())
+		err  error
+	)
+	if paused {
+		err = ioutil.WriteFile(path, nil, 0644)
+	} else if err = os.Remove(path); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		c.logger().Error("paused marker failed", "path", path, "error", err)
+	}
+	return err
+}
+
+func sigDesc(sig os.Signal) string {
 	switch sig {
 	case syscall.SIGHUP:
-		return "reload", "kill -SIGHUP XXXX"
+		return "kill -SIGHUP XXXX"
 	case syscall.SIGINT:
-		return "terminate", "kill -SIGINT XXXX or `Ctrl+C`"
+		return "kill -SIGINT XXXX or `Ctrl+C`"
 	case syscall.SIGTERM:
-		return "force terminate (kill)", "kill -SIGTERM XXXX or kill -9 XXXX"
+		return "kill -SIGTERM XXXX or kill XXXX"
 	case syscall.SIGQUIT:
-		return "terminate and core dump", "kill -SIGQUIT XXXX or `Ctrl+\\`"
+		return "kill -SIGQUIT XXXX or `Ctrl+\\`"
 	case syscall.SIGTSTP:
-		return "console terminate", "kill -SIGTSTP XXXX or `Ctrl+Z`"
+		return "kill -SIGTSTP XXXX or `Ctrl+Z`"
+	case syscall.SIGCONT:
+		return "kill -SIGCONT XXXX or `fg`"
 	}
-	return "Unknown signal", sig.String()
+	return sig.String()
 }
@@ -0,0 +1,175 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package daemon
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalActions(t *testing.T) {
+	hdlr := func() error { return nil }
+	custom := SignalFunc("rotate logs", hdlr)
+	tests := []struct {
+		name string
+		opts []ConfigOption
+		want map[os.Signal]string
+	}{
+		{
+			name: "defaults",
+			want: map[os.Signal]string{
+				syscall.SIGINT: "stop", syscall.SIGTERM: "stop", syscall.SIGQUIT: "stop", syscall.SIGTSTP: "stop",
+			},
+		},
+		{
+			name: "reload",
+			opts: []ConfigOption{WithReloadHdlr(hdlr)},
+			want: map[os.Signal]string{
+				syscall.SIGINT: "stop", syscall.SIGTERM: "stop", syscall.SIGQUIT: "stop", syscall.SIGTSTP: "stop",
+				syscall.SIGHUP: "reload",
+			},
+		},
+		{
+			name: "pause",
+			opts: []ConfigOption{WithPauseHdlr(hdlr), WithContinueHdlr(hdlr)},
+			want: map[os.Signal]string{
+				syscall.SIGINT: "stop", syscall.SIGTERM: "stop", syscall.SIGQUIT: "stop", syscall.SIGTSTP: "stop",
+				syscall.SIGUSR1: "pause", syscall.SIGUSR2: "continue",
+			},
+		},
+		{
+			name: "pause without continue handler",
+			opts: []ConfigOption{WithPauseHdlr(hdlr)},
+			want: map[os.Signal]string{
+				syscall.SIGINT: "stop", syscall.SIGTERM: "stop", syscall.SIGQUIT: "stop", syscall.SIGTSTP: "stop",
+			},
+		},
+		{
+			name: "overrides",
+			opts: []ConfigOption{
+				WithSignalAction(syscall.SIGTSTP, SignalIgnore),
+				WithSignalAction(syscall.SIGUSR1, custom),
+				WithSignalAction(syscall.SIGQUIT, SignalDumpStacks),
+			},
+			want: map[os.Signal]string{
+				syscall.SIGINT: "stop", syscall.SIGTERM: "stop", syscall.SIGQUIT: "dump stacks", syscall.SIGTSTP: "ignore",
+				syscall.SIGUSR1: "rotate logs",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig(tt.opts...)
+			got := make(map[os.Signal]string)
+			for sig, action := range c.signalActions() {
+				got[sig] = action.String()
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("signalActions() = %v, want %v", got, tt.want)
+			}
+			for sig, name := range tt.want {
+				if got[sig] != name {
+					t.Errorf("action of %s = %q, want %q", sig, got[sig], name)
+				}
+				if action, ok := c.signalAction(sig); !ok || action.String() != name {
+					t.Errorf("signalAction(%s) = %q, %v, want %q", sig, action, ok, name)
+				}
+			}
+		})
+	}
+	if action := (SignalFunc("stop", hdlr)); action.is(SignalStop) {
+		t.Error("custom action named stop is the built-in one")
+	}
+}
+
+func TestNotifySignalsIgnored(t *testing.T) {
+	var opts []ConfigOption
+	for _, sig := range []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGTSTP} {
+		opts = append(opts, WithSignalAction(sig, SignalIgnore))
+		defer signal.Reset(sig)
+	}
+	c := NewConfig(opts...)
+	ch := make(chan os.Signal, 1)
+	c.notifySignals(ch)
+	defer signal.Stop(ch)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sig := <-ch:
+		t.Errorf("notifySignals() relayed unhandled %s", sig)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPauseOrContinue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		failure   = errors.New("failure")
+		pauseErr  error
+		contErr   error
+		continued int
+		marked    bool
+		marker    = filepath.Join(dir, "svc."+strconv.Itoa(os.Getpid())+".paused")
+	)
+	c := NewConfig(
+		WithName("svc"),
+		WithPIDDir(dir),
+		WithLogger(nopLogger{}),
+		WithPauseHdlr(func() error {
+			_, statErr := os.Stat(marker)
+			marked = statErr == nil
+			return pauseErr
+		}),
+		WithContinueHdlr(func() error {
+			continued++
+			return contErr
+		}),
+	)
+	paused := func() bool {
+		_, err := os.Stat(marker)
+		return err == nil
+	}
+	c.lifecycle.set(LifecycleRunning, nil)
+
+	// failed pause keeps the service running without marker
+	pauseErr = failure
+	if err = c.pauseOrContinue(SignalPause); err != failure || paused() || c.lifecycle.get() != LifecycleRunning {
+		t.Errorf("failed pause = %v, marker %v, state %s", err, paused(), c.lifecycle.get())
+	}
+	pauseErr = nil
+	if err = c.pauseOrContinue(SignalPause); err != nil || !paused() || c.lifecycle.get() != LifecyclePaused {
+		t.Errorf("pause = %v, marker %v, state %s", err, paused(), c.lifecycle.get())
+	}
+	if marked {
+		t.Error("marker is written before PauseHdlr returned")
+	}
+	// failed continue keeps the service paused
+	contErr = failure
+	if err = c.pauseOrContinue(SignalContinue); err != failure || !paused() || c.lifecycle.get() != LifecyclePaused {
+		t.Errorf("failed continue = %v, marker %v, state %s", err, paused(), c.lifecycle.get())
+	}
+	contErr = nil
+	if err = c.pauseOrContinue(SignalContinue); err != nil || paused() || c.lifecycle.get() != LifecycleRunning {
+		t.Errorf("continue = %v, marker %v, state %s", err, paused(), c.lifecycle.get())
+	}
+
+	// service is continued if the marker can not be written
+	c.PIDDir = filepath.Join(dir, "missing")
+	continued = 0
+	if err = c.pauseOrContinue(SignalPause); err != nil || continued != 1 || c.lifecycle.get() != LifecycleRunning {
+		t.Errorf("pause without marker = %v, continued %d times, state %s", err, continued, c.lifecycle.get())
+	}
+}
@@ -16,11 +16,12 @@ import (
 // Sets WindowsStartMode to StartAutomatic.
 func NewConfig(opts ...ConfigOption) *Config {
 	cfg := &Config{
-		TemplateFreeBSDSystemV:    defaultTemplateFreeBSDSystemV,
-		TemplateLinuxSystemD:      defaultTemplateLinuxSystemD,
-		TemplateLinuxSystemV:      defaultTemplateLinuxSystemV,
-		TemplateLinuxUpstart:      defaultTemplateLinuxUpstart,
-		TemplateMacOSPorpertyList: defaultTemplateMacOSPorpertyList,
+		TemplateFreeBSDSystemV:       defaultTemplateFreeBSDSystemV,
+		TemplateLinuxSystemD:         defaultTemplateLinuxSystemD,
+		TemplateLinuxSystemDInstance: defaultTemplateLinuxSystemDInstance,
+		TemplateLinuxSystemV:         defaultTemplateLinuxSystemV,
+		TemplateLinuxUpstart:         defaultTemplateLinuxUpstart,
+		TemplateMacOSPorpertyList:    defaultTemplateMacOSPorpertyList,
 
 		ErrorHdlr: func(format string, args ...interface{}) {
 			fmt.Fprintf(os.Stderr, format+"\n", args...)
@@ -30,6 +31,8 @@ func NewConfig(opts ...ConfigOption) *Config {
 		},
 
 		WindowsStartMode: mgr.StartAutomatic,
+
+		lifecycle: &lifecycle{},
 	}
 
 	for _, opt := range opts {
@@ -39,8 +42,13 @@ func NewConfig(opts ...ConfigOption) *Config {
 	return cfg
 }
 
+// Signals are not used to control Windows services
+func (c *Config) defaultSignalActions() map[os.Signal]SignalAction {
+	return make(map[os.Signal]SignalAction)
+}
+
 func (c Config) acceptedCommands() svc.Accepted {
-	if c.PauseHdlr == nil || c.ContinueHdlr == nil {
+	if c.RunContext != nil || c.PauseHdlr == nil || c.ContinueHdlr == nil {
 		return svc.AcceptStop | svc.AcceptShutdown
 	}
 	return svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
@@ -0,0 +1,151 @@
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	crashReportPrefix = "crash-"
+	crashReportSuffix = ".txt"
+	// Time layout of report file name, sortable as string
+	crashReportTimeLayout = "20060102T150405.000000000Z"
+	// Number of kept reports if CrashReportLimit is not set
+	defaultCrashReportLimit = 10
+)
+
+// Start time of the process for uptime in crash reports
+var processStart = time.Now() // nolint:gochecknoglobals
+
+// CrashReport is a report written to Config.CrashReportDir when the service
+// panics or fails.
+type CrashReport struct {
+	// Path of the report file
+	Path string
+	// Time of the crash
+	Time time.Time
+	// Content of the report: reason, process details and goroutine stacks
+	Content string
+}
+
+// LastCrashReport returns the latest report in CrashReportDir, e.g. to
+// inspect the previous crash in StartHdlr. It returns nil report if there
+// are no reports.
+func LastCrashReport(c *Config) (*CrashReport, error) {
+	names, err := crashReports(c.CrashReportDir)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	name := names[len(names)-1]
+	path := filepath.Join(c.CrashReportDir, name)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, _ := time.Parse(crashReportTimeLayout,
+		strings.TrimSuffix(strings.TrimPrefix(name, crashReportPrefix), crashReportSuffix))
+	return &CrashReport{Path: path, Time: t, Content: string(content)}, nil
+}
+
+// List report file names in dir from oldest to newest
+func crashReports(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() && strings.HasPrefix(name, crashReportPrefix) && strings.HasSuffix(name, crashReportSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Record failure of the service: write crash report and switch lifecycle
+// to LifecycleFailed
+func (c *Config) fail(err error) {
+	if path, reportErr := c.writeCrashReport(err); reportErr != nil {
+		c.logger().Error("crash report failed", "error", reportErr)
+	} else if path != "" {
+		c.logger().Info("crash report written", "path", path)
+	}
+	c.lifecycle.set(LifecycleFailed, err)
+}
+
+// Write crash report to CrashReportDir and remove the oldest reports above
+// CrashReportLimit. It returns path of the report, empty if CrashReportDir
+// is not set.
+func (c *Config) writeCrashReport(reason error) (string, error) {
+	if c.CrashReportDir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(c.CrashReportDir, 0750); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	var b strings.Builder
+	fmt.Fprintf(&b, "time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "name: %s\n", c.Name)
+	fmt.Fprintf(&b, "reason: %v\n", reason)
+	fmt.Fprintf(&b, "state: %s\n", c.lifecycle.get())
+	fmt.Fprintf(&b, "pid: %d\n", os.Getpid())
+	fmt.Fprintf(&b, "args: %q\n", os.Args)
+	fmt.Fprintf(&b, "uptime: %s\n", now.Sub(processStart))
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "module: %s %s\n", info.Main.Path, info.Main.Version)
+	}
+	fmt.Fprintf(&b, "\n%s\n", allStacks())
+
+	path := filepath.Join(c.CrashReportDir, crashReportPrefix+now.Format(crashReportTimeLayout)+crashReportSuffix)
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0640); err != nil {
+		return "", err
+	}
+	return path, c.rotateCrashReports()
+}
+
+// Remove the oldest reports above CrashReportLimit
+func (c *Config) rotateCrashReports() error {
+	limit := c.CrashReportLimit
+	if limit <= 0 {
+		limit = defaultCrashReportLimit
+	}
+	names, err := crashReports(c.CrashReportDir)
+	if err != nil {
+		return err
+	}
+	for len(names) > limit {
+		if err = os.Remove(filepath.Join(c.CrashReportDir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Get stacks of all goroutines
+func allStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
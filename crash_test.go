@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrashReports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// older reports and unrelated files
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		name := crashReportPrefix + old.Add(time.Duration(i)*time.Hour).Format(crashReportTimeLayout) + crashReportSuffix
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte("old"), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConfig(WithName("svc"), WithLogger(nopLogger{}), WithCrashReportDir(dir), WithCrashReportLimit(2))
+	c.fail(errors.New("database is gone"))
+	if state := c.lifecycle.get(); state != LifecycleFailed {
+		t.Errorf("state = %s, want failed", state)
+	}
+	names, err := crashReports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || !strings.HasPrefix(names[0], crashReportPrefix+"20200101T020000") {
+		t.Errorf("reports = %q, want the newest old one and the new one", names)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("rotation removed unrelated file: %v", err)
+	}
+
+	report, err := LastCrashReport(c)
+	if err != nil || report == nil {
+		t.Fatalf("LastCrashReport() = %v, %v", report, err)
+	}
+	if report.Path != filepath.Join(dir, names[1]) || time.Since(report.Time) > time.Minute {
+		t.Errorf("LastCrashReport() = %s at %s, want the new report", report.Path, report.Time)
+	}
+	for _, line := range []string{"name: svc\n", "reason: database is gone\n", "state: idle\n", "goroutine "} {
+		if !strings.Contains(report.Content, line) {
+			t.Errorf("report does not contain %q:\n%s", line, report.Content)
+		}
+	}
+}
+
+func TestLastCrashReportEmpty(t *testing.T) {
+	for _, dir := range []string{"", filepath.Join(os.TempDir(), "daemon-no-such-dir")} {
+		if report, err := LastCrashReport(&Config{CrashReportDir: dir}); report != nil || err != nil {
+			t.Errorf("LastCrashReport() in %q = %v, %v, want nil, nil", dir, report, err)
+		}
+	}
+}
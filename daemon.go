@@ -1,15 +1,78 @@
 package daemon
 
+import (
+	"context"
+)
+
 // Daemon interface.
+//
+// Methods with Context suffix run external commands (systemctl, service,
+// launchctl and so on) and poll service state bound to ctx: when ctx is
+// canceled or its deadline expires, running command is killed and the
+// method returns ctx error. Methods without the suffix are equal to their
+// Context variants with context.Background().
 type Daemon interface {
 	Install(args ...string) (string, error)
+	InstallContext(ctx context.Context, args ...string) (string, error)
+	Render(args ...string) ([]ServiceFile, error)
+	Upgrade(args ...string) (UpgradeResult, error)
+	UpgradeContext(ctx context.Context, args ...string) (UpgradeResult, error)
 	Pause() (string, error)
+	PauseContext(ctx context.Context) (string, error)
 	Reload() (string, error)
+	ReloadContext(ctx context.Context) (string, error)
 	Restart() (string, error)
+	RestartContext(ctx context.Context) (string, error)
 	Continue() (string, error)
+	ContinueContext(ctx context.Context) (string, error)
 	Status() (string, error)
+	StatusContext(ctx context.Context) (string, error)
+	StatusInfo() (ServiceStatus, error)
+	StatusInfoContext(ctx context.Context) (ServiceStatus, error)
 	Start() (string, error)
+	StartContext(ctx context.Context) (string, error)
 	Stop() (string, error)
+	StopContext(ctx context.Context) (string, error)
 	Uninstall() (string, error)
+	UninstallContext(ctx context.Context) (string, error)
+	Ensure(ctx context.Context, state DesiredState) (EnsureResult, error)
+	// Instance returns Daemon managing an instance of the template unit,
+	// see Config.SystemDTemplateUnit. Install of the instance writes its
+	// drop-in file with args and enables it, Uninstall reverts that. The
+	// template unit itself is installed and uninstalled by the parent Daemon.
+	// Name must not need escaping in unit name, see ErrInvalidInstanceName.
+	Instance(name string) (Daemon, error)
+	// State returns lifecycle state of the running service process.
+	State() LifecycleState
+	// Subscribe registers fn called on every lifecycle state transition.
+	// fn is called from the run loop and must not block. Call returned
+	// function to unsubscribe.
+	Subscribe(fn func(Transition)) (unsubscribe func())
 	Run() error
 }
+
+// Operation is a name of the Daemon management operation.
+type Operation string
+
+// Daemon management operations.
+const (
+	OpInstall   Operation = "install"
+	OpRender    Operation = "render"
+	OpUpgrade   Operation = "upgrade"
+	OpUninstall Operation = "uninstall"
+	OpEnable    Operation = "enable"
+	OpDisable   Operation = "disable"
+	OpStart     Operation = "start"
+	OpStop      Operation = "stop"
+	OpRestart   Operation = "restart"
+	OpReload    Operation = "reload"
+	OpPause     Operation = "pause"
+	OpContinue  Operation = "continue"
+	OpStatus    Operation = "status"
+)
+
+// RequiresPrivileges reports whether the operation changes system state and
+// requires root privileges. Status and Render are allowed to everyone.
+func (op Operation) RequiresPrivileges() bool {
+	return op != OpStatus && op != OpRender
+}
@@ -4,11 +4,9 @@
 package daemon
 
 import (
-	"fmt"
-	"html/template"
+	"context"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"regexp"
 	"strings"
 )
@@ -32,9 +30,17 @@ func New(c *Config) (Daemon, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.InitSystem != InitSystemAuto && c.InitSystem != InitSystemRCD {
+		return nil, ErrUnsupportedSystem
+	}
 	return &daemon{c}, nil
 }
 
+// DetectInitSystem detects init system of the running host.
+func DetectInitSystem() InitSystemDetection {
+	return InitSystemDetection{InitSystemRCD, "rc.d is the only init system on FreeBSD"}
+}
+
 func (d *daemon) pidFile() string {
 	name := d.config.PIDName
 	if d.config.PIDName == "" {
@@ -43,18 +49,22 @@ func (d *daemon) pidFile() string {
 	return d.config.PIDDir + "/" + name + ".pid"
 }
 
+func (d *daemon) backend() string {
+	return string(InitSystemRCD)
+}
+
 func (d *daemon) path() string {
 	return "/usr/local/etc/rc.d/" + d.config.Name
 }
 
 func (d *daemon) installed() bool {
-	return checkInstalled(d.path())
+	return checkInstalled(d.config.rootPath(d.path()))
 }
 
 func (d *daemon) enabled() (bool, error) {
-	rcConf, err := os.Open("/etc/rc.conf")
+	rcConf, err := os.Open(d.config.rootPath("/etc/rc.conf"))
 	if err != nil {
-		fmt.Println("Error opening file:", err)
+		d.config.logger().Warn("can not read rc.conf", "backend", d.backend(), "error", err)
 		return false, err
 	}
 	defer rcConf.Close()
@@ -76,134 +86,329 @@ func (d *daemon) enabled() (bool, error) {
 
 func (d *daemon) cmd(cmd string) string {
 	if ok, err := d.enabled(); !ok || err != nil {
-		fmt.Println("Daemon is not enabled, using one" + cmd + " instead")
+		d.config.logger().Debug("service is not enabled, using one"+cmd+" instead", "backend", d.backend())
 		cmd = "one" + cmd
 	}
 	return cmd
 }
 
-func (d *daemon) running() (string, bool) {
-	return checkRunning(d.config.Name, "PID\" = ([0-9]+);", "launchctl", "list", d.config.Name)
+func (d *daemon) status(ctx context.Context) ServiceStatus {
+	var status = ServiceStatus{Backend: d.backend()}
+	status.Enabled, _ = d.enabled()
+	output, code, err := checkOutput(ctx, d.config, command("service", d.config.Name, d.cmd("status")))
+	if err != nil {
+		return status
+	}
+	status.State = StateStopped
+	if code == 0 {
+		status.State = StateRunning
+		status.PID = matchInt("pid ([0-9]+)", output)
+	}
+	return status
 }
 
 func (d *daemon) Install(args ...string) (string, error) {
+	return d.InstallContext(context.Background(), args...)
+}
+
+func (d *daemon) InstallContext(ctx context.Context, args ...string) (string, error) {
 	action := "Install " + d.config.Description + ":"
-	if ok, err := checkPrivileges(); !ok {
-		return failed(action), err
+	if err := checkPrivileges(d.config, OpInstall); err != nil {
+		return failed(action), d.error(OpInstall, err)
 	}
-	srvPath := d.path()
 	if d.installed() {
-		return failed(action), ErrAlreadyInstalled
+		return failed(action), d.error(OpInstall, ErrAlreadyInstalled)
 	}
-	file, err := os.Create(srvPath)
+	files, err := d.render(args...)
 	if err != nil {
-		return failed(action), err
+		return failed(action), d.error(OpInstall, err)
+	}
+	if err = d.install(ctx, args, files); err != nil {
+		return failed(action), d.error(OpInstall, err)
 	}
-	defer file.Close()
+	return success(action), nil
+}
+
+func (d *daemon) Render(args ...string) ([]ServiceFile, error) {
+	files, err := d.render(args...)
+	if err != nil {
+		return nil, d.error(OpRender, err)
+	}
+	return files, nil
+}
+
+// Render service files, errors are not wrapped
+func (d *daemon) render(args ...string) ([]ServiceFile, error) {
 	execPath, err := executablePath(d.config.Name)
 	if err != nil {
-		return failed(action), err
+		return nil, err
 	}
-	templ, err := template.New("bsd").Parse(d.config.TemplateFreeBSDSystemV)
+	content, err := renderTemplate("bsd", d.config.TemplateFreeBSDSystemV, &struct {
+		Name, Description, Path, Args, PIDFile string
+	}{d.config.Name, d.config.Description, execPath, strings.Join(args, " "), d.pidFile()})
 	if err != nil {
-		return failed(action), err
+		return nil, err
 	}
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args, PIDFile string
-		}{d.config.Name, d.config.Description, execPath, strings.Join(args, " "), d.pidFile()},
-	); err != nil {
-		return failed(action), err
+	return []ServiceFile{{Path: d.path(), Content: content, Mode: 0755}}, nil
+}
+
+func (d *daemon) Upgrade(args ...string) (UpgradeResult, error) {
+	return d.UpgradeContext(context.Background(), args...)
+}
+
+func (d *daemon) UpgradeContext(ctx context.Context, args ...string) (UpgradeResult, error) {
+	var result UpgradeResult
+	if err := checkPrivileges(d.config, OpUpgrade); err != nil {
+		return result, d.error(OpUpgrade, err)
 	}
-	if err := os.Chmod(srvPath, 0755); err != nil {
-		return failed(action), err
+	files, err := d.render(args...)
+	if err != nil {
+		return result, d.error(OpUpgrade, err)
 	}
-	return success(action), nil
+	if !d.installed() {
+		if err = d.install(ctx, args, files); err != nil {
+			return result, d.error(OpUpgrade, err)
+		}
+		result.Installed = true
+		return result, nil
+	}
+	// service of the host is not affected by files under RootDir
+	running := d.config.RootDir == "" && d.status(ctx).Running()
+	tx := transaction{config: d.config}
+	if result.Changed, err = tx.updateServiceFiles(files); err != nil {
+		tx.rollback()
+		result.Changed = nil
+		return result, d.error(OpUpgrade, err)
+	}
+	if len(result.Changed) == 0 || !running {
+		return result, nil
+	}
+	if err = runCommand(ctx, d.config, command("service", d.config.Name, d.cmd("restart"))); err != nil {
+		return result, d.error(OpUpgrade, err)
+	}
+	result.Restarted = true
+	return result, nil
 }
 
 func (d *daemon) Uninstall() (string, error) {
+	return d.UninstallContext(context.Background())
+}
+
+func (d *daemon) UninstallContext(ctx context.Context) (string, error) {
 	action := "Uninstalling " + d.config.Description + ":"
-	if ok, err := checkPrivileges(); !ok {
-		return failed(action), err
+	if err := checkPrivileges(d.config, OpUninstall); err != nil {
+		return failed(action), d.error(OpUninstall, err)
 	}
 	if !d.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpUninstall, ErrNotInstalled)
 	}
-	if err := os.Remove(d.path()); err != nil {
-		return failed(action), err
+	if err := d.withHooks(ctx, OpUninstall, nil, func() error {
+		return os.Remove(d.config.rootPath(d.path()))
+	}, nil); err != nil {
+		return failed(action), d.error(OpUninstall, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Start() (string, error) {
+	return d.StartContext(context.Background())
+}
+
+func (d *daemon) StartContext(ctx context.Context) (string, error) {
 	action := "Starting " + d.config.Description + ":"
-	if ok, err := checkPrivileges(); !ok {
-		return failed(action), err
+	if err := checkPrivileges(d.config, OpStart); err != nil {
+		return failed(action), d.error(OpStart, err)
 	}
 	if !d.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpStart, ErrNotInstalled)
 	}
-	if _, ok := d.running(); ok {
-		return failed(action), ErrAlreadyRunning
+	if d.status(ctx).Running() {
+		return failed(action), d.error(OpStart, ErrAlreadyRunning)
 	}
-	if err := exec.Command("service", d.config.Name, d.cmd("start")).Run(); err != nil {
-		return failed(action), err
+	if err := ctx.Err(); err != nil {
+		return failed(action), d.error(OpStart, err)
+	}
+	if err := d.withHooks(ctx, OpStart, nil, func() error {
+		return runCommand(ctx, d.config, command("service", d.config.Name, d.cmd("start")))
+	}, func() error {
+		return runCommand(context.Background(), d.config, command("service", d.config.Name, d.cmd("stop")))
+	}); err != nil {
+		return failed(action), d.error(OpStart, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Restart() (string, error) {
+	return d.RestartContext(context.Background())
+}
+
+func (d *daemon) RestartContext(ctx context.Context) (string, error) {
 	action := "Restarting " + d.config.Description + ":"
-	if ok, err := checkPrivileges(); !ok {
-		return failed(action), err
+	if err := checkPrivileges(d.config, OpRestart); err != nil {
+		return failed(action), d.error(OpRestart, err)
 	}
 	if !d.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpRestart, ErrNotInstalled)
 	}
-	if err := exec.Command("service", d.config.Name, d.cmd("restart")).Run(); err != nil {
-		return failed(action), err
+	if err := d.withHooks(ctx, OpRestart, nil, func() error {
+		return runCommand(ctx, d.config, command("service", d.config.Name, d.cmd("restart")))
+	}, nil); err != nil {
+		return failed(action), d.error(OpRestart, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Stop() (string, error) {
+	return d.StopContext(context.Background())
+}
+
+func (d *daemon) StopContext(ctx context.Context) (string, error) {
 	action := "Stopping " + d.config.Description + ":"
-	if ok, err := checkPrivileges(); !ok {
-		return failed(action), err
+	if err := checkPrivileges(d.config, OpStop); err != nil {
+		return failed(action), d.error(OpStop, err)
 	}
 	if !d.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpStop, ErrNotInstalled)
 	}
-	if _, ok := d.running(); !ok {
-		return failed(action), ErrAlreadyStopped
+	if !d.status(ctx).Running() {
+		if err := ctx.Err(); err != nil {
+			return failed(action), d.error(OpStop, err)
+		}
+		return failed(action), d.error(OpStop, ErrAlreadyStopped)
 	}
-	if err := exec.Command("service", d.config.Name, d.cmd("stop")).Run(); err != nil {
-		return failed(action), err
+	if err := d.withHooks(ctx, OpStop, nil, func() error {
+		return runCommand(ctx, d.config, command("service", d.config.Name, d.cmd("stop")))
+	}, func() error {
+		return runCommand(context.Background(), d.config, command("service", d.config.Name, d.cmd("start")))
+	}); err != nil {
+		return failed(action), d.error(OpStop, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Status() (string, error) {
-	if ok, err := checkPrivileges(); !ok {
+	return d.StatusContext(context.Background())
+}
+
+func (d *daemon) StatusContext(ctx context.Context) (string, error) {
+	status, err := d.StatusInfoContext(ctx)
+	if err != nil && status.State != StateNotInstalled {
 		return "", err
 	}
+	return status.String(), err
+}
+
+func (d *daemon) StatusInfo() (ServiceStatus, error) {
+	return d.StatusInfoContext(context.Background())
+}
+
+func (d *daemon) StatusInfoContext(ctx context.Context) (ServiceStatus, error) {
+	var status = ServiceStatus{Backend: d.backend()}
+	if err := checkPrivileges(d.config, OpStatus); err != nil {
+		return status, d.error(OpStatus, err)
+	}
 	if !d.installed() {
-		return statusNotInstalled, ErrNotInstalled
+		status.State = StateNotInstalled
+		return status, d.error(OpStatus, ErrNotInstalled)
 	}
-	status, _ := d.running()
-	return status, nil
+	status = d.status(ctx)
+	return status, d.error(OpStatus, ctx.Err())
 }
 
 func (d *daemon) Reload() (string, error) {
-	return "", ErrUnsupportedSystem
+	return d.ReloadContext(context.Background())
+}
+
+func (d *daemon) ReloadContext(ctx context.Context) (string, error) {
+	return "", d.error(OpReload, ErrUnsupportedSystem)
+}
+
+func (d *daemon) Ensure(ctx context.Context, state DesiredState) (EnsureResult, error) {
+	return ensure(ctx, d, state)
+}
+
+func (d *daemon) Instance(name string) (Daemon, error) {
+	return nil, ErrUnsupportedSystem
+}
+
+func (d *daemon) enable(ctx context.Context) error {
+	return d.setEnabled(ctx, OpEnable, "YES")
+}
+
+func (d *daemon) disable(ctx context.Context) error {
+	return d.setEnabled(ctx, OpDisable, "NO")
+}
+
+// Set rc.conf variable enabling the service
+func (d *daemon) setEnabled(ctx context.Context, op Operation, value string) error {
+	if err := checkPrivileges(d.config, op); err != nil {
+		return d.error(op, err)
+	}
+	if !d.installed() {
+		return d.error(op, ErrNotInstalled)
+	}
+	var args []string
+	if d.config.RootDir != "" {
+		args = append(args, "-R", d.config.RootDir)
+	}
+	args = append(args, d.config.Name+"_enable="+value)
+	return d.error(op, runCommand(ctx, d.config, command("sysrc", args...)))
 }
 
 func (d *daemon) Pause() (string, error) {
-	return "", ErrUnsupportedSystem
+	return d.PauseContext(context.Background())
+}
+
+func (d *daemon) PauseContext(ctx context.Context) (string, error) {
+	return "", d.error(OpPause, ErrUnsupportedSystem)
 }
+
 func (d *daemon) Continue() (string, error) {
-	return "", ErrUnsupportedSystem
+	return d.ContinueContext(context.Background())
+}
+
+func (d *daemon) ContinueContext(ctx context.Context) (string, error) {
+	return "", d.error(OpContinue, ErrUnsupportedSystem)
+}
+
+// Write service files between Install hooks. Files are removed if post
+// hook fails.
+func (d *daemon) install(ctx context.Context, args []string, files []ServiceFile) error {
+	tx := transaction{config: d.config}
+	err := d.withHooks(ctx, OpInstall, args, func() error {
+		return tx.writeServiceFiles(files)
+	}, func() error {
+		tx.rollback()
+		return nil
+	})
+	if err != nil {
+		tx.rollback()
+	}
+	return err
+}
+
+// Run step of the operation between hooks
+func (d *daemon) withHooks(ctx context.Context, op Operation, args []string, fn, undo func() error) error {
+	return d.config.runWithHooks(ctx, HookInfo{
+		Op:      op,
+		Name:    d.config.Name,
+		Backend: d.backend(),
+		Path:    d.config.rootPath(d.path()),
+		Args:    args,
+	}, fn, undo)
+}
+
+// Wrap error of the operation with backend details
+func (d *daemon) error(op Operation, err error) error {
+	return wrapError(op, d.backend(), d.config.rootPath(d.path()), err)
+}
+
+func (d *daemon) State() LifecycleState {
+	return d.config.lifecycle.get()
+}
+
+func (d *daemon) Subscribe(fn func(Transition)) func() {
+	return d.config.lifecycle.subscribe(fn)
 }
 
 // Run - Run service
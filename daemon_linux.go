@@ -4,10 +4,16 @@
 package daemon
 
 import (
+	"context"
 	"os"
 	"strconv"
+	"syscall"
+	"time"
 )
 
+// Time the run loop has to confirm pause or continue
+const pauseConfirmTimeout = 10 * time.Second
+
 type daemon struct {
 	specific daemonSpecific
 	config   *Config
@@ -31,150 +37,420 @@ func New(c *Config) (Daemon, error) {
 	if err != nil {
 		return nil, err
 	}
-	// newer subsystem must be checked first
-	if _, err = os.Stat("/run/systemd/system"); err == nil {
-		specific = &daemonSystemD{c}
-	} else if _, err = os.Stat("/sbin/initctl"); err == nil {
+	var system = c.InitSystem
+	if system == InitSystemAuto {
+		system = DetectInitSystem().System
+	}
+	switch system {
+	case InitSystemSystemD:
+		if specific, err = newDaemonSystemD(c); err != nil {
+			return nil, err
+		}
+	case InitSystemUpstart:
 		specific = &daemonUpstart{c}
-	} else {
+	case InitSystemSystemV:
 		specific = &daemonSystemV{c}
+	default:
+		return nil, ErrUnsupportedSystem
+	}
+	if c.SystemDUserScope && system != InitSystemSystemD {
+		return nil, ErrUnsupportedSystem
 	}
 	return &daemon{specific, c}, nil
 }
 
+// DetectInitSystem detects init system of the running host.
+func DetectInitSystem() InitSystemDetection {
+	// newer subsystem must be checked first
+	if _, err := os.Stat("/run/systemd/system"); err == nil {
+		return InitSystemDetection{InitSystemSystemD, "/run/systemd/system exists"}
+	}
+	if _, err := os.Stat("/sbin/initctl"); err == nil {
+		return InitSystemDetection{InitSystemUpstart, "/run/systemd/system does not exist, /sbin/initctl exists"}
+	}
+	return InitSystemDetection{InitSystemSystemV, "neither /run/systemd/system nor /sbin/initctl exist"}
+}
+
 func (d *daemon) Install(args ...string) (string, error) {
+	return d.InstallContext(context.Background(), args...)
+}
+
+func (d *daemon) InstallContext(ctx context.Context, args ...string) (string, error) {
 	var (
 		action = "Install " + d.config.Description + ":"
-		ok     bool
 		err    error
 	)
-	if ok, err = checkPrivileges(); !ok {
-		return failed(action), err
+	if err = d.checkPrivileges(OpInstall); err != nil {
+		return failed(action), d.error(OpInstall, err)
 	}
 	if d.specific.installed() {
-		return failed(action), ErrAlreadyInstalled
+		return failed(action), d.error(OpInstall, ErrAlreadyInstalled)
 	}
-	if err = d.specific.Install(args...); err != nil {
-		return failed(action), err
+	if err = d.install(ctx, args...); err != nil {
+		return failed(action), d.error(OpInstall, err)
 	}
 	return success(action), nil
 }
 
+func (d *daemon) Render(args ...string) ([]ServiceFile, error) {
+	files, err := d.specific.render(args...)
+	return files, d.error(OpRender, err)
+}
+
+func (d *daemon) Upgrade(args ...string) (UpgradeResult, error) {
+	return d.UpgradeContext(context.Background(), args...)
+}
+
+func (d *daemon) UpgradeContext(ctx context.Context, args ...string) (UpgradeResult, error) {
+	var (
+		result  UpgradeResult
+		files   []ServiceFile
+		running bool
+		err     error
+	)
+	if err = d.checkPrivileges(OpUpgrade); err != nil {
+		return result, d.error(OpUpgrade, err)
+	}
+	if !d.specific.installed() {
+		if err = d.install(ctx, args...); err != nil {
+			return result, d.error(OpUpgrade, err)
+		}
+		result.Installed = true
+		return result, nil
+	}
+	if files, err = d.specific.render(args...); err != nil {
+		return result, d.error(OpUpgrade, err)
+	}
+	if t, ok := d.specific.(enabledReporter); ok && !t.enabled() {
+		// run level symlinks enable the service at boot, disabled service
+		// must stay disabled
+		files = withoutSymlinks(files)
+	}
+	// service of the host is not affected by files under RootDir
+	running = d.config.RootDir == "" && d.specific.status(ctx).Running()
+	if err = ctx.Err(); err != nil {
+		return result, d.error(OpUpgrade, err)
+	}
+	tx := transaction{config: d.config}
+	if result.Changed, err = tx.updateServiceFiles(files); err != nil {
+		tx.rollback()
+		result.Changed = nil
+		return result, d.error(OpUpgrade, err)
+	}
+	if len(result.Changed) == 0 || d.config.RootDir != "" {
+		return result, nil
+	}
+	if result.Reloaded, err = d.specific.reloadDefinitions(ctx); err != nil {
+		tx.rollback()
+		// ctx may be already done, restored definitions are reloaded anyway
+		_, _ = d.specific.reloadDefinitions(context.Background())
+		result.Changed, result.Reloaded = nil, false
+		return result, d.error(OpUpgrade, err)
+	}
+	if running {
+		// stop and start instead of restart: Upstart does not re-read job
+		// definition on restart
+		if err = d.specific.Stop(ctx); err != nil {
+			return result, d.error(OpUpgrade, err)
+		}
+		if err = d.specific.Start(ctx); err != nil {
+			return result, d.error(OpUpgrade, err)
+		}
+		result.Restarted = true
+	}
+	return result, nil
+}
+
 func (d *daemon) Uninstall() (string, error) {
+	return d.UninstallContext(context.Background())
+}
+
+func (d *daemon) UninstallContext(ctx context.Context) (string, error) {
 	var (
 		action = "Uninstalling " + d.config.Description + ":"
-		ok     bool
 		err    error
 	)
-	if ok, err = checkPrivileges(); !ok {
-		return failed(action), err
+	if err = d.checkPrivileges(OpUninstall); err != nil {
+		return failed(action), d.error(OpUninstall, err)
 	}
 	if !d.specific.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpUninstall, ErrNotInstalled)
 	}
-	if err = d.specific.Uninstall(); err != nil {
-		return failed(action), err
+	if err = d.withHooks(ctx, OpUninstall, nil, func() error {
+		return d.specific.Uninstall(ctx)
+	}, nil); err != nil {
+		return failed(action), d.error(OpUninstall, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Restart() (string, error) {
+	return d.RestartContext(context.Background())
+}
+
+func (d *daemon) RestartContext(ctx context.Context) (string, error) {
 	var (
 		action = "Restarting " + d.config.Description + ":"
-		ok     bool
 		err    error
 	)
-	if ok, err = checkPrivileges(); !ok {
-		return failed(action), err
+	if err = d.checkPrivileges(OpRestart); err != nil {
+		return failed(action), d.error(OpRestart, err)
 	}
 	if !d.specific.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpRestart, ErrNotInstalled)
 	}
-	if err = d.specific.Restart(); err != nil {
-		return failed(action), err
+	if err = d.withHooks(ctx, OpRestart, nil, func() error {
+		return d.specific.Restart(ctx)
+	}, nil); err != nil {
+		return failed(action), d.error(OpRestart, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Start() (string, error) {
+	return d.StartContext(context.Background())
+}
+
+func (d *daemon) StartContext(ctx context.Context) (string, error) {
 	var (
 		action = "Starting " + d.config.Description + ":"
-		ok     bool
 		err    error
 	)
-	if ok, err = checkPrivileges(); !ok {
-		return failed(action), err
+	if err = d.checkPrivileges(OpStart); err != nil {
+		return failed(action), d.error(OpStart, err)
 	}
 	if !d.specific.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpStart, ErrNotInstalled)
 	}
-	if _, ok = d.specific.running(); ok {
-		return failed(action), ErrAlreadyRunning
+	if d.specific.status(ctx).Running() {
+		return failed(action), d.error(OpStart, ErrAlreadyRunning)
 	}
-	if err = d.specific.Start(); err != nil {
-		return failed(action), err
+	if err = ctx.Err(); err != nil {
+		return failed(action), d.error(OpStart, err)
+	}
+	if err = d.withHooks(ctx, OpStart, nil, func() error {
+		return d.specific.Start(ctx)
+	}, func() error {
+		return d.specific.Stop(context.Background())
+	}); err != nil {
+		return failed(action), d.error(OpStart, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Stop() (string, error) {
+	return d.StopContext(context.Background())
+}
+
+func (d *daemon) StopContext(ctx context.Context) (string, error) {
 	var (
 		action = "Stopping " + d.config.Description + ":"
-		ok     bool
 		err    error
 	)
-	if ok, err = checkPrivileges(); !ok {
-		return failed(action), err
+	if err = d.checkPrivileges(OpStop); err != nil {
+		return failed(action), d.error(OpStop, err)
 	}
 	if !d.specific.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpStop, ErrNotInstalled)
 	}
-	if _, ok = d.specific.running(); !ok {
-		return failed(action), ErrAlreadyStopped
+	if !d.specific.status(ctx).Running() {
+		if err = ctx.Err(); err != nil {
+			return failed(action), d.error(OpStop, err)
+		}
+		return failed(action), d.error(OpStop, ErrAlreadyStopped)
 	}
-	if err = d.specific.Stop(); err != nil {
-		return failed(action), err
+	if err = d.withHooks(ctx, OpStop, nil, func() error {
+		return d.specific.Stop(ctx)
+	}, func() error {
+		return d.specific.Start(context.Background())
+	}); err != nil {
+		return failed(action), d.error(OpStop, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Status() (string, error) {
-	if ok, err := checkPrivileges(); !ok {
+	return d.StatusContext(context.Background())
+}
+
+func (d *daemon) StatusContext(ctx context.Context) (string, error) {
+	status, err := d.StatusInfoContext(ctx)
+	if err != nil && status.State != StateNotInstalled {
 		return "", err
 	}
+	return status.String(), err
+}
+
+func (d *daemon) StatusInfo() (ServiceStatus, error) {
+	return d.StatusInfoContext(context.Background())
+}
+
+func (d *daemon) StatusInfoContext(ctx context.Context) (ServiceStatus, error) {
+	var status = ServiceStatus{Backend: d.specific.backend()}
+	if err := d.checkPrivileges(OpStatus); err != nil {
+		return status, d.error(OpStatus, err)
+	}
 	if !d.specific.installed() {
-		return statusNotInstalled, ErrNotInstalled
+		status.State = StateNotInstalled
+		return status, d.error(OpStatus, ErrNotInstalled)
 	}
-	status, _ := d.specific.running()
-	return status, nil
+	status = d.status(ctx)
+	return status, d.error(OpStatus, ctx.Err())
 }
 
 func (d *daemon) Reload() (string, error) {
+	return d.ReloadContext(context.Background())
+}
+
+func (d *daemon) ReloadContext(ctx context.Context) (string, error) {
 	var (
 		action = "Stopping " + d.config.Description + ":"
-		ok     bool
 		err    error
 	)
-	if ok, err = checkPrivileges(); !ok {
-		return failed(action), err
+	if err = d.checkPrivileges(OpReload); err != nil {
+		return failed(action), d.error(OpReload, err)
 	}
 	if !d.specific.installed() {
-		return failed(action), ErrNotInstalled
+		return failed(action), d.error(OpReload, ErrNotInstalled)
 	}
-	if _, ok = d.specific.running(); !ok {
-		return failed(action), ErrNotStarted
+	if !d.specific.status(ctx).Running() {
+		if err = ctx.Err(); err != nil {
+			return failed(action), d.error(OpReload, err)
+		}
+		return failed(action), d.error(OpReload, ErrNotStarted)
 	}
-	if err = d.specific.Reload(); err != nil {
-		return failed(action), err
+	if err = d.withHooks(ctx, OpReload, nil, func() error {
+		return d.specific.Reload(ctx)
+	}, nil); err != nil {
+		return failed(action), d.error(OpReload, err)
 	}
 	return success(action), nil
 }
 
+func (d *daemon) Ensure(ctx context.Context, state DesiredState) (EnsureResult, error) {
+	return ensure(ctx, d, state)
+}
+
+func (d *daemon) enable(ctx context.Context) error {
+	if err := d.checkPrivileges(OpEnable); err != nil {
+		return d.error(OpEnable, err)
+	}
+	if !d.specific.installed() {
+		return d.error(OpEnable, ErrNotInstalled)
+	}
+	return d.error(OpEnable, d.specific.enable(ctx))
+}
+
+func (d *daemon) disable(ctx context.Context) error {
+	if err := d.checkPrivileges(OpDisable); err != nil {
+		return d.error(OpDisable, err)
+	}
+	if !d.specific.installed() {
+		return d.error(OpDisable, ErrNotInstalled)
+	}
+	return d.error(OpDisable, d.specific.disable(ctx))
+}
+
 func (d *daemon) Pause() (string, error) {
-	return "", ErrUnsupportedSystem
+	return d.PauseContext(context.Background())
 }
+
+func (d *daemon) PauseContext(ctx context.Context) (string, error) {
+	return d.signal(ctx, OpPause, "Pausing "+d.config.Description+":", d.config.PauseSignal)
+}
+
 func (d *daemon) Continue() (string, error) {
-	return "", ErrUnsupportedSystem
+	return d.ContinueContext(context.Background())
+}
+
+func (d *daemon) ContinueContext(ctx context.Context) (string, error) {
+	return d.signal(ctx, OpContinue, "Continuing "+d.config.Description+":", d.config.ContinueSignal)
+}
+
+// Send signal to the main process of the running service. Pause and
+// Continue use it to deliver request to the run loop.
+func (d *daemon) signal(ctx context.Context, op Operation, action string, sig os.Signal) (string, error) {
+	var err error
+	if err = d.checkPrivileges(op); err != nil {
+		return failed(action), d.error(op, err)
+	}
+	if !d.config.pausable() {
+		return failed(action), d.error(op, ErrSomeMethodsNotSpecified)
+	}
+	signum, ok := sig.(syscall.Signal)
+	if !ok {
+		return failed(action), d.error(op, ErrUnsupportedSystem)
+	}
+	if !d.specific.installed() {
+		return failed(action), d.error(op, ErrNotInstalled)
+	}
+	status := d.specific.status(ctx)
+	if !status.Running() || status.PID == 0 {
+		if err = ctx.Err(); err != nil {
+			return failed(action), d.error(op, err)
+		}
+		return failed(action), d.error(op, ErrNotStarted)
+	}
+	if err = d.withHooks(ctx, op, nil, func() error {
+		if err := runCommand(ctx, d.config, command("kill", "-"+strconv.Itoa(int(signum)), strconv.Itoa(status.PID))); err != nil {
+			return err
+		}
+		return d.waitPaused(ctx, status.PID, op == OpPause)
+	}, nil); err != nil {
+		return failed(action), d.error(op, err)
+	}
+	return success(action), nil
+}
+
+// Wait until the run loop of the process confirms pause or continue with
+// paused marker
+func (d *daemon) waitPaused(ctx context.Context, pid int, paused bool) error {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, pauseConfirmTimeout)
+	defer cancel()
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for checkInstalled(d.config.pausedFile(pid)) != paused {
+		select {
+		case <-ctx.Done():
+			if err := parent.Err(); err != nil {
+				return err
+			}
+			return ErrPauseNotConfirmed
+		case <-tick.C:
+		}
+	}
+	return nil
+}
+
+// Get status of the service. Running service process marked as paused by
+// the run loop is reported as paused.
+func (d *daemon) status(ctx context.Context) ServiceStatus {
+	status := d.specific.status(ctx)
+	if status.State == StateRunning && status.PID > 0 && checkInstalled(d.config.pausedFile(status.PID)) {
+		status.State = StatePaused
+	}
+	return status
+}
+
+func (d *daemon) Instance(name string) (Daemon, error) {
+	t, ok := d.specific.(instancer)
+	if !ok {
+		return nil, ErrUnsupportedSystem
+	}
+	specific, err := t.instanceOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return &daemon{specific, d.config}, nil
+}
+
+func (d *daemon) State() LifecycleState {
+	return d.config.lifecycle.get()
+}
+
+func (d *daemon) Subscribe(fn func(Transition)) func() {
+	return d.config.lifecycle.subscribe(fn)
 }
 
 // Run - Run service
@@ -182,17 +458,86 @@ func (d *daemon) Run() error {
 	return d.config.RunHdlr()
 }
 
+// Install service between Install hooks. Install steps are rolled back if
+// the backend or post hook fails.
+func (d *daemon) install(ctx context.Context, args ...string) error {
+	tx := transaction{config: d.config}
+	err := d.withHooks(ctx, OpInstall, args, func() error {
+		return d.specific.Install(ctx, &tx, args...)
+	}, func() error {
+		tx.rollback()
+		return nil
+	})
+	if err != nil {
+		tx.rollback()
+	}
+	return err
+}
+
+// Run backend step of the operation between hooks
+func (d *daemon) withHooks(ctx context.Context, op Operation, args []string, fn, undo func() error) error {
+	return d.config.runWithHooks(ctx, HookInfo{
+		Op:      op,
+		Name:    d.config.Name,
+		Backend: d.specific.backend(),
+		Path:    d.config.rootPath(d.specific.path()),
+		Args:    args,
+	}, fn, undo)
+}
+
+// Check root rights unless the service is managed by user service manager.
+// Config.PrivilegesCheck is called in every scope.
+func (d *daemon) checkPrivileges(op Operation) error {
+	if d.config.SystemDUserScope && d.config.PrivilegesCheck == nil {
+		return nil
+	}
+	return checkPrivileges(d.config, op)
+}
+
+// Wrap error of the operation with backend details
+func (d *daemon) error(op Operation, err error) error {
+	return wrapError(op, d.specific.backend(), d.config.rootPath(d.specific.path()), err)
+}
+
 type daemonSpecific interface {
-	Install(args ...string) error
-	Reload() error
-	Restart() error
-	Start() error
-	Stop() error
-	Uninstall() error
+	// Install records performed steps in tx, caller rolls them back on
+	// failure
+	Install(ctx context.Context, tx *transaction, args ...string) error
+	render(args ...string) ([]ServiceFile, error)
+	reloadDefinitions(ctx context.Context) (bool, error)
+	enable(ctx context.Context) error
+	disable(ctx context.Context) error
+	Reload(ctx context.Context) error
+	Restart(ctx context.Context) error
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Uninstall(ctx context.Context) error
 
+	backend() string
 	path() string
 	installed() bool
-	running() (string, bool)
+	status(ctx context.Context) ServiceStatus
+}
+
+// Init system backend with template services
+type instancer interface {
+	instanceOf(name string) (daemonSpecific, error)
+}
+
+// Init system backend reporting whether the service is enabled
+type enabledReporter interface {
+	enabled() bool
+}
+
+// Filter out symlinks from service files
+func withoutSymlinks(files []ServiceFile) []ServiceFile {
+	var result []ServiceFile
+	for _, file := range files {
+		if file.Mode&os.ModeSymlink == 0 {
+			result = append(result, file)
+		}
+	}
+	return result
 }
 
 func runLevels(levels []int) []string {
@@ -4,14 +4,63 @@
 package daemon
 
 import (
-	"html/template"
+	"context"
 	"os"
-	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Unit properties requested from systemd to build ServiceStatus
+var systemdProperties = []string{
+	"LoadState",
+	"ActiveState",
+	"SubState",
+	"MainPID",
+	"UnitFileState",
+	"ExecMainStatus",
+	"ActiveEnterTimestamp",
+}
+
+// Prepare systemctl command with forced C locale and disabled pager, so its
+// output does not depend on user environment
+func systemctl(args ...string) Command {
+	return Command{
+		Name: "systemctl",
+		Args: append([]string{"--no-pager"}, args...),
+		Env:  []string{"LC_ALL=C", "SYSTEMD_PAGER="},
+	}
+}
+
 type daemonSystemD struct {
 	config *Config
+	// dir is a directory of unit files: system one or user one in user
+	// scope
+	dir string
+	// instance is a name of template unit instance, it is empty for the
+	// template unit itself
+	instance string
+}
+
+// Create systemd backend. Unit directory of user scope is resolved from
+// environment of the process.
+func newDaemonSystemD(c *Config) (*daemonSystemD, error) {
+	var d = &daemonSystemD{config: c, dir: "/etc/systemd/system"}
+	if !c.SystemDUserScope {
+		return d, nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		d.dir = filepath.Join(dir, "systemd", "user")
+		return d, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	d.dir = filepath.Join(home, ".config", "systemd", "user")
+	return d, nil
 }
 
 func (d *daemonSystemD) pidFile() string {
@@ -22,79 +71,331 @@ func (d *daemonSystemD) pidFile() string {
 	return d.config.PIDDir + "/" + name + ".pid"
 }
 
+// Prepare systemctl command talking to the service manager of the scope
+func (d *daemonSystemD) systemctl(args ...string) Command {
+	if d.config.SystemDUserScope {
+		return systemctl(append([]string{"--user"}, args...)...)
+	}
+	return systemctl(args...)
+}
+
+// Get target which pulls the service in at boot or at login in user scope
+func (d *daemonSystemD) wantedBy() string {
+	if d.config.SystemDUserScope {
+		return "default.target"
+	}
+	return "multi-user.target"
+}
+
+// Get unit name: "name.service", template "name@.service" or its instance
+// "name@instance.service"
+func (d *daemonSystemD) unit() string {
+	if d.config.SystemDTemplateUnit {
+		return d.config.Name + "@" + d.instance + ".service"
+	}
+	return d.config.Name + ".service"
+}
+
+// Get path of unit file. Instance of template unit is installed as drop-in
+// file of the instance.
 func (d *daemonSystemD) path() string {
-	return "/etc/systemd/system/" + d.config.Name + ".service"
+	if d.instance != "" {
+		return d.dir + "/" + d.unit() + ".d/daemon.conf"
+	}
+	return d.dir + "/" + d.unit()
+}
+
+// Get instance of the template unit
+func (d *daemonSystemD) instanceOf(name string) (daemonSpecific, error) {
+	if !d.config.SystemDTemplateUnit || d.instance != "" {
+		return nil, ErrNotTemplateUnit
+	}
+	if !validInstanceName(name) || len(d.config.Name+"@"+name+".service") > maxUnitNameLength {
+		return nil, ErrInvalidInstanceName
+	}
+	return &daemonSystemD{d.config, d.dir, name}, nil
+}
+
+// Maximum length of systemd unit name
+const maxUnitNameLength = 255
+
+// Check instance name consists of characters valid in unit names, other
+// ones must be escaped for systemd
+func validInstanceName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune(":-_.", r)) {
+			return false
+		}
+	}
+	return true
 }
 
 func (d *daemonSystemD) installed() bool {
-	return checkInstalled(d.path())
+	return checkInstalled(d.config.rootPath(d.path()))
+}
+
+func (d *daemonSystemD) backend() string {
+	return string(InitSystemSystemD)
+}
+
+func (d *daemonSystemD) status(ctx context.Context) ServiceStatus {
+	var status = ServiceStatus{Backend: d.backend()}
+	props, err := d.show(ctx)
+	if err != nil {
+		return status
+	}
+	status.Properties = props
+	if props["LoadState"] == "not-found" {
+		status.State = StateNotInstalled
+		return status
+	}
+	status.State = systemdState(props["ActiveState"])
+	status.Enabled = props["UnitFileState"] == "enabled" || props["UnitFileState"] == "enabled-runtime"
+	status.ExitCode, _ = strconv.Atoi(props["ExecMainStatus"])
+	if status.Running() {
+		status.PID, _ = strconv.Atoi(props["MainPID"])
+		status.ActiveSince = systemdTimestamp(props["ActiveEnterTimestamp"])
+	}
+	return status
 }
 
-func (d *daemonSystemD) running() (string, bool) {
-	return checkRunning("Active: active", "Main PID: ([0-9]+)", "systemctl", "status", d.config.Name+".service")
+// Read unit properties using machine-readable output of `systemctl show`
+func (d *daemonSystemD) show(ctx context.Context) (map[string]string, error) {
+	output, _, err := checkOutput(ctx, d.config, d.systemctl(
+		"show", "--property="+strings.Join(systemdProperties, ","), d.unit(),
+	))
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string, len(systemdProperties))
+	for _, line := range strings.Split(output, "\n") {
+		if i := strings.IndexByte(line, '='); i > 0 {
+			props[line[:i]] = line[i+1:]
+		}
+	}
+	return props, nil
 }
 
-func (d *daemonSystemD) Install(args ...string) error {
+// Parse timestamp property printed by systemctl in local time zone. Zone
+// abbreviations unknown to Go, e.g. "+03", get zero offset, so time of such
+// zone is read as local wall clock.
+func systemdTimestamp(value string) time.Time {
+	t, err := time.ParseInLocation("Mon 2006-01-02 15:04:05 MST", value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	if name, offset := t.Zone(); offset == 0 && name != "UTC" && name != "GMT" && t.Location() != time.Local {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	}
+	return t
+}
+
+// Convert systemd ActiveState to ServiceState
+func systemdState(activeState string) ServiceState {
+	switch activeState {
+	case "active":
+		return StateRunning
+	case "reloading":
+		return StateReloading
+	case "inactive":
+		return StateStopped
+	case "failed":
+		return StateFailed
+	case "activating":
+		return StateStarting
+	case "deactivating":
+		return StateStopping
+	}
+	return StateUnknown
+}
+
+// Prepare enable or disable command. Unit symlinks are managed under RootDir
+// if it is set.
+func (d *daemonSystemD) unitFileCommand(verb string) Command {
+	if d.config.RootDir != "" {
+		return d.systemctl("--root="+d.config.RootDir, verb, d.unit())
+	}
+	return d.systemctl(verb, d.unit())
+}
+
+func (d *daemonSystemD) render(args ...string) ([]ServiceFile, error) {
+	execPath, err := executablePath(d.config.Name)
+	if err != nil {
+		return nil, err
+	}
 	var (
-		srvPath  = d.path()
-		file     *os.File
-		execPath string
-		templ    *template.Template
-		err      error
+		name     = "systemd"
+		text     = d.config.TemplateLinuxSystemD
+		instance string
 	)
-	if file, err = os.Create(srvPath); err != nil {
-		return err
+	if d.instance != "" {
+		name, text, instance = "systemdInstance", d.config.TemplateLinuxSystemDInstance, d.instance
+	} else if d.config.SystemDTemplateUnit {
+		// systemd replaces the specifier with instance name
+		instance = "%i"
 	}
-	defer file.Close()
-	if execPath, err = executablePath(d.config.Name); err != nil {
+	content, err := renderTemplate(name, text, &struct {
+		Name, Description, Dependencies, Path, Args, PIDFile, Instance, WantedBy string
+		SuccessExitStatus, RestartPreventExitStatus                              string
+	}{
+		d.config.Name,
+		d.config.Description,
+		strings.Join(d.config.Dependencies, " "),
+		execPath,
+		strings.Join(args, " "),
+		d.pidFile(),
+		instance,
+		d.wantedBy(),
+		joinExitCodes(successExitCodes),
+		joinExitCodes(restartPreventExitCodes),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []ServiceFile{{Path: d.path(), Content: content, Mode: 0644}}, nil
+}
+
+func (d *daemonSystemD) Install(ctx context.Context, tx *transaction, args ...string) error {
+	files, err := d.render(args...)
+	if err != nil {
 		return err
 	}
-	if templ, err = template.New("systemd").Parse(d.config.TemplateLinuxSystemD); err != nil {
+	if d.config.SystemDUserScope {
+		// user configuration directory may not exist yet
+		if err = os.MkdirAll(d.config.rootPath(d.dir), 0755); err != nil {
+			return err
+		}
+	}
+	if d.instance != "" {
+		if err = d.makeDropInDir(tx); err != nil {
+			return err
+		}
+	}
+	if d.config.RootDir == "" {
+		// undo steps run in reverse order, so reload is the last one
+		tx.add(func() error {
+			// rollback must complete even if ctx is done
+			return runCommand(context.Background(), d.config, d.systemctl("daemon-reload"))
+		})
+	}
+	if err = tx.writeServiceFiles(files); err != nil {
 		return err
 	}
-	if err = templ.Execute(
-		file,
-		&struct {
-			Name, Description, Dependencies, Path, Args, PIDFile string
-		}{
-			d.config.Name,
-			d.config.Description,
-			strings.Join(d.config.Dependencies, " "),
-			execPath,
-			strings.Join(args, " "),
-			d.pidFile(),
-		},
-	); err != nil {
+	if d.config.RootDir == "" {
+		if err = runCommand(ctx, d.config, d.systemctl("daemon-reload")); err != nil {
+			return err
+		}
+	}
+	if d.config.SystemDUserScope && d.config.SystemDLinger && d.config.RootDir == "" && !lingering() {
+		// user manager is started at boot and is not stopped at logout
+		if err = runCommand(ctx, d.config, command("loginctl", "enable-linger")); err != nil {
+			return err
+		}
+		tx.add(func() error {
+			return runCommand(context.Background(), d.config, command("loginctl", "disable-linger"))
+		})
+	}
+	if d.config.SystemDTemplateUnit && d.instance == "" {
+		// template unit is enabled per instance
+		return nil
+	}
+	if err = runCommand(ctx, d.config, d.unitFileCommand("enable")); err != nil {
 		return err
 	}
-	if err = exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+	tx.add(func() error {
+		return runCommand(context.Background(), d.config, d.unitFileCommand("disable"))
+	})
+	return nil
+}
+
+// Check whether lingering is already enabled for the current user. Unknown
+// state is reported as enabled, so it is not changed on rollback.
+func lingering() bool {
+	u, err := user.Current()
+	if err != nil {
+		return true
+	}
+	return checkInstalled("/var/lib/systemd/linger/" + u.Username)
+}
+
+// Create drop-in directory of the instance. Template unit must be installed
+// before its instances.
+func (d *daemonSystemD) makeDropInDir(tx *transaction) error {
+	var template = &daemonSystemD{config: d.config, dir: d.dir}
+	if !template.installed() {
+		return &OperationError{Path: d.config.rootPath(template.path()), Err: ErrNotInstalled}
+	}
+	dir := filepath.Dir(d.config.rootPath(d.path()))
+	if checkInstalled(dir) {
+		return nil
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
 		return err
 	}
-	err = exec.Command("systemctl", "enable", d.config.Name+".service").Run()
-	return err
+	tx.add(func() error {
+		return os.Remove(dir)
+	})
+	return nil
+}
+
+func (d *daemonSystemD) enable(ctx context.Context) error {
+	return runCommand(ctx, d.config, d.unitFileCommand("enable"))
 }
 
-func (d *daemonSystemD) Uninstall() error {
-	var err = exec.Command("systemctl", "disable", d.config.Name+".service").Run()
+func (d *daemonSystemD) disable(ctx context.Context) error {
+	return runCommand(ctx, d.config, d.unitFileCommand("disable"))
+}
+
+func (d *daemonSystemD) reloadDefinitions(ctx context.Context) (bool, error) {
+	return true, runCommand(ctx, d.config, d.systemctl("daemon-reload"))
+}
+
+func (d *daemonSystemD) Uninstall(ctx context.Context) error {
+	var err = runCommand(ctx, d.config, d.unitFileCommand("disable"))
 	if err != nil {
 		return err
 	}
-	err = os.Remove(d.path())
+	if d.config.SystemDTemplateUnit && d.instance == "" {
+		// disabling of template disables all its instances, drop-in files
+		// of the instances are removed with template
+		dropIns, _ := filepath.Glob(d.config.rootPath(d.dir + "/" + d.config.Name + "@?*.service.d/daemon.conf"))
+		for _, path := range dropIns {
+			if err = removeDropIn(path); err != nil {
+				return err
+			}
+		}
+	}
+	if d.instance != "" {
+		return removeDropIn(d.config.rootPath(d.path()))
+	}
+	err = os.Remove(d.config.rootPath(d.path()))
 	return err
 }
 
-func (d *daemonSystemD) Restart() error {
-	return exec.Command("systemctl", "restart", d.config.Name+".service").Run()
+// Remove drop-in file and its directory if it is empty
+func removeDropIn(path string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	_ = os.Remove(filepath.Dir(path))
+	return nil
+}
+
+func (d *daemonSystemD) Restart(ctx context.Context) error {
+	return runCommand(ctx, d.config, d.systemctl("restart", d.unit()))
 }
 
-func (d *daemonSystemD) Start() error {
-	return exec.Command("systemctl", "start", d.config.Name+".service").Run()
+func (d *daemonSystemD) Start(ctx context.Context) error {
+	return runCommand(ctx, d.config, d.systemctl("start", d.unit()))
 }
 
-func (d *daemonSystemD) Stop() error {
-	return exec.Command("systemctl", "stop", d.config.Name+".service").Run()
+func (d *daemonSystemD) Stop(ctx context.Context) error {
+	return runCommand(ctx, d.config, d.systemctl("stop", d.unit()))
 }
 
-func (d *daemonSystemD) Reload() error {
-	return exec.Command("systemctl", "reload", d.config.Name+".service").Run()
+func (d *daemonSystemD) Reload(ctx context.Context) error {
+	return runCommand(ctx, d.config, d.systemctl("reload", d.unit()))
 }
@@ -4,9 +4,8 @@
 package daemon
 
 import (
-	"html/template"
+	"context"
 	"os"
-	"os/exec"
 	"strings"
 )
 
@@ -35,100 +34,158 @@ func (d *daemonSystemV) path() string {
 }
 
 func (d *daemonSystemV) installed() bool {
-	return checkInstalled(d.path())
+	return checkInstalled(d.config.rootPath(d.path()))
 }
 
-func (d *daemonSystemV) running() (string, bool) {
-	return checkRunning(d.config.Name, "pid  ([0-9]+)", "service", d.config.Name, "status")
+// Get path of run level symlink with kind "S" (start) or "K" (kill)
+func (d *daemonSystemV) rcPath(lvl, kind string) string {
+	if kind == "S" {
+		return "/etc/rc" + lvl + ".d/S87" + d.config.Name
+	}
+	return "/etc/rc" + lvl + ".d/K17" + d.config.Name
 }
 
-func (d *daemonSystemV) Install(args ...string) error {
-	var (
-		srvPath  = d.path()
-		file     *os.File
-		execPath string
-		templ    *template.Template
-		lvl      string
-		err      error
-	)
-	file, err = os.Create(srvPath)
+func (d *daemonSystemV) backend() string {
+	return string(InitSystemSystemV)
+}
+
+func (d *daemonSystemV) enabled() bool {
+	for _, lvl := range d.startRunLevels() {
+		// symlink target is not resolvable under RootDir
+		if _, err := os.Lstat(d.config.rootPath(d.rcPath(lvl, "S"))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *daemonSystemV) status(ctx context.Context) ServiceStatus {
+	var status = ServiceStatus{Backend: d.backend(), Enabled: d.enabled()}
+	output, code, err := checkOutput(ctx, d.config, command("service", d.config.Name, "status"))
 	if err != nil {
-		return err
+		return status
 	}
-	defer file.Close()
-	execPath, err = executablePath(d.config.Name)
+	// exit codes are defined by LSB for init script status action
+	switch code {
+	case 0:
+		status.State = StateRunning
+	case 1, 2:
+		status.State = StateFailed
+	case 3:
+		status.State = StateStopped
+	default:
+		return status
+	}
+	if status.Running() {
+		if status.PID = matchInt("pid  ([0-9]+)", output); status.PID == 0 {
+			status.PID = readPIDFile(d.config.rootPath(d.pidFile()))
+		}
+		if info, err := os.Stat(d.config.rootPath(d.pidFile())); err == nil {
+			status.ActiveSince = info.ModTime()
+		}
+	}
+	return status
+}
+
+func (d *daemonSystemV) render(args ...string) ([]ServiceFile, error) {
+	execPath, err := executablePath(d.config.Name)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	templ, err = template.New("systemV").Parse(d.config.TemplateLinuxSystemV)
+	content, err := renderTemplate("systemV", d.config.TemplateLinuxSystemV, &struct {
+		Name, Description, Path, Args, PIDFile, StartRunLevels, StopRunLevels string
+	}{
+		d.config.Name,
+		d.config.Description,
+		execPath,
+		strings.Join(args, " "),
+		d.pidFile(),
+		strings.Join(d.startRunLevels(), " "),
+		strings.Join(d.stopRunLevels(), " "),
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args, PIDFile, StartRunLevels, StopRunLevels string
-		}{
-			d.config.Name,
-			d.config.Description,
-			execPath,
-			strings.Join(args, " "),
-			d.pidFile(),
-			strings.Join(d.startRunLevels(), " "),
-			strings.Join(d.stopRunLevels(), " "),
-		},
-	); err != nil {
-		return err
+	files := []ServiceFile{{Path: d.path(), Content: content, Mode: 0755}}
+	return append(files, d.links()...), nil
+}
+
+// Get run level symlinks to init script
+func (d *daemonSystemV) links() []ServiceFile {
+	var links []ServiceFile
+	for _, lvl := range d.startRunLevels() {
+		links = append(links, ServiceFile{Path: d.rcPath(lvl, "S"), Mode: os.ModeSymlink | 0777, Target: d.path()})
 	}
-	if err = os.Chmod(srvPath, 0755); err != nil {
-		return err
+	for _, lvl := range d.stopRunLevels() {
+		links = append(links, ServiceFile{Path: d.rcPath(lvl, "K"), Mode: os.ModeSymlink | 0777, Target: d.path()})
 	}
-	for _, lvl = range d.startRunLevels() {
-		if err = os.Symlink(srvPath, "/etc/rc"+lvl+".d/S87"+d.config.Name); err != nil {
-			continue
-		}
+	return links
+}
+
+func (d *daemonSystemV) enable(ctx context.Context) error {
+	var tx = transaction{config: d.config}
+	_, err := tx.updateServiceFiles(d.links())
+	if err != nil {
+		tx.rollback()
 	}
-	for _, lvl = range d.stopRunLevels() {
-		if err = os.Symlink(srvPath, "/etc/rc"+lvl+".d/K17"+d.config.Name); err != nil {
-			continue
+	return err
+}
+
+func (d *daemonSystemV) disable(ctx context.Context) error {
+	for _, link := range d.links() {
+		if err := os.Remove(d.config.rootPath(link.Path)); err != nil && !os.IsNotExist(err) {
+			return err
 		}
 	}
 	return nil
 }
 
-func (d *daemonSystemV) Uninstall() error {
+func (d *daemonSystemV) Install(ctx context.Context, tx *transaction, args ...string) error {
+	files, err := d.render(args...)
+	if err != nil {
+		return err
+	}
+	return tx.writeServiceFiles(files)
+}
+
+// Init scripts are read on every call, nothing to reload
+func (d *daemonSystemV) reloadDefinitions(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+func (d *daemonSystemV) Uninstall(ctx context.Context) error {
 	var (
 		err error
 		lvl string
 	)
-	if err = os.Remove(d.path()); err != nil {
+	if err = os.Remove(d.config.rootPath(d.path())); err != nil {
 		return err
 	}
 	for _, lvl = range d.startRunLevels() {
-		if err = os.Remove("/etc/rc" + lvl + ".d/S87" + d.config.Name); err != nil {
+		if err = os.Remove(d.config.rootPath(d.rcPath(lvl, "S"))); err != nil {
 			continue
 		}
 	}
 	for _, lvl = range d.stopRunLevels() {
-		if err = os.Remove("/etc/rc" + lvl + ".d/K17" + d.config.Name); err != nil {
+		if err = os.Remove(d.config.rootPath(d.rcPath(lvl, "K"))); err != nil {
 			continue
 		}
 	}
 	return nil
 }
 
-func (d *daemonSystemV) Restart() error {
-	return exec.Command("service", d.config.Name, "restart").Run()
+func (d *daemonSystemV) Restart(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("service", d.config.Name, "restart"))
 }
 
-func (d *daemonSystemV) Start() error {
-	return exec.Command("service", d.config.Name, "start").Run()
+func (d *daemonSystemV) Start(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("service", d.config.Name, "start"))
 }
 
-func (d *daemonSystemV) Stop() error {
-	return exec.Command("service", d.config.Name, "stop").Run()
+func (d *daemonSystemV) Stop(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("service", d.config.Name, "stop"))
 }
 
-func (d *daemonSystemV) Reload() error {
-	return exec.Command("service", d.config.Name, "reload").Run()
+func (d *daemonSystemV) Reload(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("service", d.config.Name, "reload"))
 }
@@ -0,0 +1,693 @@
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	daemon "github.com/nsemikov/go-daemon"
+	"github.com/nsemikov/go-daemon/daemontest"
+)
+
+// Create daemon managed by faked init system with files under temporary
+// RootDir
+func newTestDaemon(t *testing.T, system daemon.InitSystem, exe *daemontest.Executor, opts ...daemon.ConfigOption) (daemon.Daemon, string) {
+	t.Helper()
+	root, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	for _, dir := range []string{
+		"etc/systemd/system", "etc/init", "etc/init.d",
+		"etc/rc0.d", "etc/rc1.d", "etc/rc2.d", "etc/rc3.d", "etc/rc4.d", "etc/rc5.d", "etc/rc6.d",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts = append([]daemon.ConfigOption{
+		daemon.WithName("svc"),
+		daemon.WithDescription("Test service"),
+		daemon.WithInitSystem(system),
+		daemon.WithRootDir(root),
+		daemon.WithExecutor(exe),
+		daemon.WithPrivilegesCheck(daemontest.Privileged),
+		daemon.WithStartHdlr(func() error { return nil }),
+		daemon.WithStopHdlr(func() error { return nil }),
+		daemon.WithHideMethodsWarning(true),
+	}, opts...)
+	d, err := daemon.New(daemon.NewConfig(opts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, root
+}
+
+// Compare command lines, nil and empty are equal
+func equalLines(a, b []string) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+// Replace {root} in expected command lines
+func withRoot(lines []string, root string) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, strings.Replace(line, "{root}", root, -1))
+	}
+	return result
+}
+
+var sysvLinks = []string{
+	"/etc/rc2.d/S87svc", "/etc/rc3.d/S87svc", "/etc/rc4.d/S87svc", "/etc/rc5.d/S87svc",
+	"/etc/rc0.d/K17svc", "/etc/rc1.d/K17svc", "/etc/rc6.d/K17svc",
+}
+
+func TestInstallUpgradeUninstall(t *testing.T) {
+	tests := []struct {
+		system    daemon.InitSystem
+		path      string
+		links     []string
+		install   []string
+		upgraded  []string
+		uninstall []string
+		start     []string
+	}{
+		{
+			system:    daemon.InitSystemSystemD,
+			path:      "/etc/systemd/system/svc.service",
+			install:   []string{"systemctl --no-pager --root={root} enable svc.service"},
+			upgraded:  []string{"/etc/systemd/system/svc.service"},
+			uninstall: []string{"systemctl --no-pager --root={root} disable svc.service"},
+			start: []string{
+				"systemctl --no-pager show --property=LoadState,ActiveState,SubState,MainPID,UnitFileState,ExecMainStatus,ActiveEnterTimestamp svc.service",
+				"systemctl --no-pager start svc.service",
+			},
+		},
+		{
+			system:   daemon.InitSystemSystemV,
+			path:     "/etc/init.d/svc",
+			links:    sysvLinks,
+			upgraded: []string{"/etc/init.d/svc"},
+			start:    []string{"service svc status", "service svc start"},
+		},
+		{
+			system:   daemon.InitSystemUpstart,
+			path:     "/etc/init/svc.conf",
+			upgraded: []string{"/etc/init/svc.conf"},
+			start:    []string{"service svc status", "start svc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.system), func(t *testing.T) {
+			exe := daemontest.NewExecutor().On("service svc status", daemontest.Response{ExitCode: 3})
+			d, root := newTestDaemon(t, tt.system, exe)
+
+			if _, err := d.Install("--flag"); err != nil {
+				t.Fatalf("Install() error = %v", err)
+			}
+			content, err := ioutil.ReadFile(filepath.Join(root, tt.path))
+			if err != nil {
+				t.Fatalf("Install() did not write %s: %v", tt.path, err)
+			}
+			if !strings.Contains(string(content), "--flag") {
+				t.Errorf("Install() wrote %s without args:\n%s", tt.path, content)
+			}
+			for _, link := range tt.links {
+				if target, err := os.Readlink(filepath.Join(root, link)); err != nil || target != tt.path {
+					t.Errorf("Install() link %s = %q, %v, want %q", link, target, err, tt.path)
+				}
+			}
+			if got, want := exe.Commands(), withRoot(tt.install, root); !equalLines(got, want) {
+				t.Errorf("Install() commands = %q, want %q", got, want)
+			}
+
+			exe.Reset()
+			result, err := d.Upgrade("--flag")
+			if err != nil || len(result.Changed) > 0 || len(exe.Commands()) > 0 {
+				t.Errorf("Upgrade() of up to date service = %+v, %v, commands %q", result, err, exe.Commands())
+			}
+			result, err = d.Upgrade("--other")
+			if err != nil {
+				t.Fatalf("Upgrade() error = %v", err)
+			}
+			if !reflect.DeepEqual(result.Changed, tt.upgraded) {
+				t.Errorf("Upgrade() changed = %q, want %q", result.Changed, tt.upgraded)
+			}
+
+			exe.Reset()
+			if _, err = d.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			if got := exe.Commands(); !equalLines(got, tt.start) {
+				t.Errorf("Start() commands = %q, want %q", got, tt.start)
+			}
+
+			exe.Reset()
+			if _, err = d.Uninstall(); err != nil {
+				t.Fatalf("Uninstall() error = %v", err)
+			}
+			for _, path := range append([]string{tt.path}, tt.links...) {
+				if _, err := os.Lstat(filepath.Join(root, path)); !os.IsNotExist(err) {
+					t.Errorf("Uninstall() did not remove %s", path)
+				}
+			}
+			if got, want := exe.Commands(), withRoot(tt.uninstall, root); !equalLines(got, want) {
+				t.Errorf("Uninstall() commands = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSystemDStatus(t *testing.T) {
+	// zone unknown to Go unless it is the local one
+	local := time.Local
+	time.Local = time.FixedZone("XYZ", 3*60*60)
+	defer func() { time.Local = local }()
+	since := time.Date(2024, 3, 1, 10, 20, 30, 0, time.Local)
+
+	tests := []struct {
+		name string
+		show string
+		want daemon.ServiceStatus
+	}{
+		{
+			name: "running",
+			show: "LoadState=loaded\nActiveState=active\nSubState=running\nMainPID=42\nUnitFileState=enabled\n" +
+				"ExecMainStatus=0\nActiveEnterTimestamp=" + since.Format("Mon 2006-01-02 15:04:05 MST") + "\n",
+			want: daemon.ServiceStatus{State: daemon.StateRunning, PID: 42, Enabled: true, ActiveSince: since},
+		},
+		{
+			name: "zone without abbreviation",
+			show: "LoadState=loaded\nActiveState=active\nSubState=running\nMainPID=42\nUnitFileState=enabled\n" +
+				"ExecMainStatus=0\nActiveEnterTimestamp=" + since.Format("Mon 2006-01-02 15:04:05") + " +03\n",
+			want: daemon.ServiceStatus{State: daemon.StateRunning, PID: 42, Enabled: true, ActiveSince: since},
+		},
+		{
+			name: "failed",
+			show: "LoadState=loaded\nActiveState=failed\nSubState=failed\nMainPID=0\nUnitFileState=disabled\n" +
+				"ExecMainStatus=78\nActiveEnterTimestamp=\n",
+			want: daemon.ServiceStatus{State: daemon.StateFailed, ExitCode: 78},
+		},
+		{
+			name: "not found",
+			show: "LoadState=not-found\nActiveState=inactive\nSubState=dead\nMainPID=0\nUnitFileState=\n",
+			want: daemon.ServiceStatus{State: daemon.StateNotInstalled},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exe := daemontest.NewExecutor().On("systemctl --no-pager show", daemontest.Response{Stdout: tt.show})
+			d, _ := newTestDaemon(t, daemon.InitSystemSystemD, exe)
+			if _, err := d.Install(); err != nil {
+				t.Fatalf("Install() error = %v", err)
+			}
+			status, err := d.StatusInfo()
+			if err != nil {
+				t.Fatalf("StatusInfo() error = %v", err)
+			}
+			if status.State != tt.want.State || status.PID != tt.want.PID || status.Enabled != tt.want.Enabled ||
+				status.ExitCode != tt.want.ExitCode || !status.ActiveSince.Equal(tt.want.ActiveSince) {
+				t.Errorf("StatusInfo() = %+v, want %+v", status, tt.want)
+			}
+			if status.Properties["SubState"] == "" {
+				t.Errorf("StatusInfo() properties = %v, want SubState", status.Properties)
+			}
+		})
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	exe := daemontest.NewExecutor().On("systemctl --no-pager start", daemontest.Response{
+		ExitCode: 5,
+		Stderr:   "Failed to start svc.service: Unit svc.service not found.\n",
+	})
+	d, root := newTestDaemon(t, daemon.InitSystemSystemD, exe)
+	if _, err := d.Install(); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	_, err := d.Start()
+	var opErr *daemon.OperationError
+	if !errors.As(err, &opErr) || !errors.Is(err, daemon.ErrCommandFailed) {
+		t.Fatalf("Start() error = %v, want failed command", err)
+	}
+	want := daemon.OperationError{
+		Op:       daemon.OpStart,
+		Backend:  "systemd",
+		Path:     filepath.Join(root, "/etc/systemd/system/svc.service"),
+		Command:  []string{"systemctl", "--no-pager", "start", "svc.service"},
+		ExitCode: 5,
+	}
+	if opErr.Op != want.Op || opErr.Backend != want.Backend || opErr.Path != want.Path ||
+		!reflect.DeepEqual(opErr.Command, want.Command) || opErr.ExitCode != want.ExitCode {
+		t.Errorf("Start() error = %#v, want %#v", opErr, want)
+	}
+	if got := opErr.Output(); got != "Failed to start svc.service: Unit svc.service not found." {
+		t.Errorf("Output() = %q, want stderr of systemctl", got)
+	}
+}
+
+func TestUpgradeKeepsSystemVDisabled(t *testing.T) {
+	exe := daemontest.NewExecutor().On("service svc status", daemontest.Response{ExitCode: 3})
+	d, root := newTestDaemon(t, daemon.InitSystemSystemV, exe)
+	if _, err := d.Ensure(context.Background(), daemon.DesiredState{Installed: true}); err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	result, err := d.Upgrade("--other")
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	if want := []string{"/etc/init.d/svc"}; !reflect.DeepEqual(result.Changed, want) {
+		t.Errorf("Upgrade() changed = %q, want %q", result.Changed, want)
+	}
+	for _, link := range sysvLinks {
+		if _, err := os.Lstat(filepath.Join(root, link)); !os.IsNotExist(err) {
+			t.Errorf("Upgrade() re-created %s of disabled service", link)
+		}
+	}
+}
+
+func TestInstallRollback(t *testing.T) {
+	install := []string{
+		"systemctl --no-pager --user daemon-reload",
+		"loginctl enable-linger",
+		"systemctl --no-pager --user enable svc.service",
+	}
+	rollback := []string{
+		"loginctl disable-linger",
+		"systemctl --no-pager --user daemon-reload",
+	}
+	tests := []struct {
+		name     string
+		exe      *daemontest.Executor
+		opts     []daemon.ConfigOption
+		rollback []string
+	}{
+		{
+			name:     "enable fails",
+			exe:      daemontest.NewExecutor().On("systemctl --no-pager --user enable", daemontest.Response{ExitCode: 1}),
+			rollback: rollback,
+		},
+		{
+			name: "post hook fails",
+			exe:  daemontest.NewExecutor(),
+			opts: []daemon.ConfigOption{daemon.WithPostHook(daemon.OpInstall, func(ctx context.Context, info daemon.HookInfo) error {
+				return errors.New("hook failed")
+			})},
+			rollback: append([]string{"systemctl --no-pager --user disable svc.service"}, rollback...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// user units are installed to XDG_CONFIG_HOME of the host
+			home, err := ioutil.TempDir("", "daemon")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(home)
+			defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+			os.Setenv("XDG_CONFIG_HOME", home)
+
+			d, _ := newTestDaemon(t, daemon.InitSystemSystemD, tt.exe, append([]daemon.ConfigOption{
+				daemon.WithRootDir(""),
+				daemon.WithSystemDUserScope(true),
+				daemon.WithSystemDLinger(true),
+			}, tt.opts...)...)
+			if _, err = d.Install(); err == nil {
+				t.Fatal("Install() error = nil, want failure")
+			}
+			if want := append(append([]string(nil), install...), tt.rollback...); !equalLines(tt.exe.Commands(), want) {
+				t.Errorf("Install() commands = %q, want %q", tt.exe.Commands(), want)
+			}
+			if _, err = os.Stat(filepath.Join(home, "systemd/user/svc.service")); !os.IsNotExist(err) {
+				t.Errorf("Install() left unit file, stat error = %v", err)
+			}
+		})
+	}
+}
+
+func TestStartCancelled(t *testing.T) {
+	exe := daemontest.NewExecutor()
+	var hooked bool
+	d, _ := newTestDaemon(t, daemon.InitSystemSystemD, exe, daemon.WithPreHook(daemon.OpStart, func(ctx context.Context, info daemon.HookInfo) error {
+		hooked = true
+		return nil
+	}))
+	if _, err := d.Install(); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	exe.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.StartContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("StartContext() error = %v, want context.Canceled", err)
+	}
+	for _, line := range exe.Commands() {
+		if strings.Contains(line, " start ") {
+			t.Errorf("StartContext() ran %q with cancelled context", line)
+		}
+	}
+	if hooked {
+		t.Error("StartContext() ran pre hook with cancelled context")
+	}
+}
+
+func TestSystemDInstance(t *testing.T) {
+	exe := daemontest.NewExecutor()
+	d, root := newTestDaemon(t, daemon.InitSystemSystemD, exe, daemon.WithSystemDTemplateUnit(true))
+	if _, err := d.Install("--tenant=%i"); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if got := exe.Commands(); len(got) > 0 {
+		t.Errorf("Install() of template commands = %q, want none", got)
+	}
+	for _, name := range []string{"", "a/b", "a b", `a\x20b`, "tenanté", strings.Repeat("a", 250)} {
+		if _, err := d.Instance(name); !errors.Is(err, daemon.ErrInvalidInstanceName) {
+			t.Errorf("Instance(%q) error = %v, want ErrInvalidInstanceName", name, err)
+		}
+	}
+	inst, err := d.Instance("tenant-a:1.x_y")
+	if err != nil {
+		t.Fatalf("Instance() error = %v", err)
+	}
+	if _, err = inst.Instance("b"); !errors.Is(err, daemon.ErrNotTemplateUnit) {
+		t.Errorf("Instance() of instance error = %v, want ErrNotTemplateUnit", err)
+	}
+	if _, err = inst.Install("--verbose"); err != nil {
+		t.Fatalf("Install() of instance error = %v", err)
+	}
+	dropIn := filepath.Join(root, "/etc/systemd/system/svc@tenant-a:1.x_y.service.d/daemon.conf")
+	if content, err := ioutil.ReadFile(dropIn); err != nil || !strings.Contains(string(content), "--verbose") {
+		t.Errorf("Install() of instance wrote %q, %v, want drop-in with args", content, err)
+	}
+	want := withRoot([]string{"systemctl --no-pager --root={root} enable svc@tenant-a:1.x_y.service"}, root)
+	if got := exe.Commands(); !equalLines(got, want) {
+		t.Errorf("Install() of instance commands = %q, want %q", got, want)
+	}
+
+	exe.Reset()
+	if _, err = d.Uninstall(); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if _, err = os.Stat(filepath.Dir(dropIn)); !os.IsNotExist(err) {
+		t.Errorf("Uninstall() of template left drop-in directory of instance")
+	}
+	want = withRoot([]string{"systemctl --no-pager --root={root} disable svc@.service"}, root)
+	if got := exe.Commands(); !equalLines(got, want) {
+		t.Errorf("Uninstall() commands = %q, want %q", got, want)
+	}
+}
+
+func TestSystemDUserScope(t *testing.T) {
+	home, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("HOME", home)
+	os.Unsetenv("XDG_CONFIG_HOME")
+
+	exe := daemontest.NewExecutor()
+	d, root := newTestDaemon(t, daemon.InitSystemSystemD, exe, daemon.WithSystemDUserScope(true))
+	if _, err = d.Install(); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	unit := filepath.Join(root, home, ".config/systemd/user/svc.service")
+	if content, err := ioutil.ReadFile(unit); err != nil || !strings.Contains(string(content), "WantedBy=default.target") {
+		t.Errorf("Install() wrote %q, %v, want user unit", content, err)
+	}
+	want := withRoot([]string{"systemctl --no-pager --user --root={root} enable svc.service"}, root)
+	if got := exe.Commands(); !equalLines(got, want) {
+		t.Errorf("Install() commands = %q, want %q", got, want)
+	}
+
+	// privileges check override is called in user scope as well
+	d, _ = newTestDaemon(t, daemon.InitSystemSystemD, exe,
+		daemon.WithSystemDUserScope(true),
+		daemon.WithPrivilegesCheck(daemontest.Unprivileged),
+	)
+	if _, err = d.Install(); !errors.Is(err, daemon.ErrRootPrivileges) {
+		t.Errorf("Install() error = %v, want ErrRootPrivileges from PrivilegesCheck", err)
+	}
+
+	os.Unsetenv("HOME")
+	if _, err = daemon.New(daemon.NewConfig(
+		daemon.WithName("svc"),
+		daemon.WithInitSystem(daemon.InitSystemSystemD),
+		daemon.WithSystemDUserScope(true),
+		daemon.WithHideMethodsWarning(true),
+	)); err == nil {
+		t.Error("New() error = nil, want error without HOME")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	exe := daemontest.NewExecutor().On("service svc status", daemontest.Response{ExitCode: 3})
+	var infos []daemon.HookInfo
+	record := func(ctx context.Context, info daemon.HookInfo) error {
+		infos = append(infos, info)
+		return nil
+	}
+	d, root := newTestDaemon(t, daemon.InitSystemSystemV, exe,
+		daemon.WithPreHook(daemon.OpInstall, record),
+		daemon.WithPostHook(daemon.OpInstall, record),
+		daemon.WithPostHook(daemon.OpStart, func(ctx context.Context, info daemon.HookInfo) error {
+			return errors.New("not healthy")
+		}),
+	)
+	if _, err := d.Install("--flag"); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	info := daemon.HookInfo{
+		Op:      daemon.OpInstall,
+		Name:    "svc",
+		Backend: "sysv",
+		Path:    filepath.Join(root, "/etc/init.d/svc"),
+		Args:    []string{"--flag"},
+	}
+	if want := []daemon.HookInfo{info, info}; !reflect.DeepEqual(infos, want) {
+		t.Errorf("Install() hooks got %+v, want %+v", infos, want)
+	}
+
+	exe.Reset()
+	if _, err := d.Start(); err == nil || !strings.Contains(err.Error(), "post-start hook: not healthy") {
+		t.Fatalf("Start() error = %v, want post hook error", err)
+	}
+	want := []string{"service svc status", "service svc start", "service svc stop"}
+	if got := exe.Commands(); !equalLines(got, want) {
+		t.Errorf("Start() commands = %q, want %q", got, want)
+	}
+}
+
+// Run the service loop of d, its lifecycle transitions are sent to the
+// returned channel
+func runDaemon(t *testing.T, d daemon.Daemon) (<-chan daemon.Transition, <-chan error) {
+	t.Helper()
+	transitions := make(chan daemon.Transition, 16)
+	t.Cleanup(d.Subscribe(func(tr daemon.Transition) {
+		transitions <- tr
+	}))
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run()
+	}()
+	return transitions, done
+}
+
+// Wait for transition to the state, earlier transitions are returned
+func waitState(t *testing.T, transitions <-chan daemon.Transition, state daemon.LifecycleState) []string {
+	t.Helper()
+	var seen []string
+	for {
+		select {
+		case tr := <-transitions:
+			seen = append(seen, tr.From.String()+" -> "+tr.To.String())
+			if tr.To == state {
+				return seen
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("state %s is not reached, transitions %q", state, seen)
+		}
+	}
+}
+
+// Send signal to the test process, handled by the service loop
+func kill(t *testing.T, sig syscall.Signal) {
+	t.Helper()
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	d, _ := newTestDaemon(t, daemon.InitSystemSystemD, daemontest.NewExecutor(),
+		daemon.WithLogger(nopLogger{}),
+		daemon.WithReloadHdlr(func() error { return nil }),
+	)
+	transitions, done := runDaemon(t, d)
+	got := waitState(t, transitions, daemon.LifecycleRunning)
+	if d.State() != daemon.LifecycleRunning {
+		t.Errorf("State() = %s, want running", d.State())
+	}
+	kill(t, syscall.SIGHUP)
+	got = append(got, waitState(t, transitions, daemon.LifecycleRunning)...)
+	kill(t, syscall.SIGTERM)
+	got = append(got, waitState(t, transitions, daemon.LifecycleStopped)...)
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	want := []string{
+		"idle -> starting", "starting -> running",
+		"running -> reloading", "reloading -> running",
+		"running -> stopping", "stopping -> stopped",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions = %q, want %q", got, want)
+	}
+}
+
+// Logger dropping all messages
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+func TestRunExitCode(t *testing.T) {
+	d, root := newTestDaemon(t, daemon.InitSystemSystemD, daemontest.NewExecutor(),
+		daemon.WithLogger(nopLogger{}),
+		daemon.WithStartHdlr(func() error { return errors.New("port is busy") }),
+	)
+	if err := d.Run(); daemon.ExitCode(err) != daemon.ExitCodeStartFailed {
+		t.Errorf("Run() = %v, exit code %d, want %d", err, daemon.ExitCode(err), daemon.ExitCodeStartFailed)
+	}
+	if _, err := d.Install(); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(root, "/etc/systemd/system/svc.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"SuccessExitStatus=130", "RestartPreventExitStatus=78"} {
+		if !strings.Contains(string(content), line+"\n") {
+			t.Errorf("Install() wrote unit without %s:\n%s", line, content)
+		}
+	}
+}
+
+func TestRunSignalAction(t *testing.T) {
+	rotated := make(chan struct{}, 1)
+	d, _ := newTestDaemon(t, daemon.InitSystemSystemD, daemontest.NewExecutor(),
+		daemon.WithLogger(nopLogger{}),
+		daemon.WithSignalAction(syscall.SIGUSR1, daemon.SignalFunc("rotate logs", func() error {
+			rotated <- struct{}{}
+			return errors.New("keeps running")
+		})),
+	)
+	defer signal.Reset(syscall.SIGUSR1)
+	transitions, done := runDaemon(t, d)
+	waitState(t, transitions, daemon.LifecycleRunning)
+	kill(t, syscall.SIGUSR1)
+	select {
+	case <-rotated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("custom signal action is not called")
+	}
+	if state := d.State(); state != daemon.LifecycleRunning {
+		t.Errorf("State() after failed custom action = %s, want running", state)
+	}
+	kill(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+// Executor delivering kill commands to the test process, other commands
+// are faked
+type killExecutor struct {
+	*daemontest.Executor
+}
+
+func (e killExecutor) Execute(ctx context.Context, cmd daemon.Command) (daemon.CommandResult, error) {
+	if cmd.Name == "kill" && len(cmd.Args) == 2 {
+		signum, _ := strconv.Atoi(strings.TrimPrefix(cmd.Args[0], "-"))
+		pid, _ := strconv.Atoi(cmd.Args[1])
+		if err := syscall.Kill(pid, syscall.Signal(signum)); err != nil {
+			return daemon.CommandResult{ExitCode: 1}, err
+		}
+	}
+	return e.Executor.Execute(ctx, cmd)
+}
+
+func TestPauseContinue(t *testing.T) {
+	var (
+		stopped   = make(chan struct{}, 1)
+		pauseErrs = make(chan error, 1)
+		exe       = daemontest.NewExecutor().On("systemctl --no-pager show", daemontest.Response{
+			Stdout: "LoadState=loaded\nActiveState=active\nMainPID=" + strconv.Itoa(os.Getpid()) + "\nUnitFileState=enabled\n",
+		})
+	)
+	// paused marker is written by the run loop of the test process
+	runtimeDir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+	d, _ := newTestDaemon(t, daemon.InitSystemSystemD, exe,
+		daemon.WithLogger(nopLogger{}),
+		daemon.WithExecutor(killExecutor{exe}),
+		daemon.WithPIDDir(runtimeDir),
+		daemon.WithStopHdlr(func() error { stopped <- struct{}{}; return nil }),
+		daemon.WithPauseHdlr(func() error {
+			select {
+			case err := <-pauseErrs:
+				return err
+			default:
+				return nil
+			}
+		}),
+		daemon.WithContinueHdlr(func() error { return nil }),
+	)
+	defer signal.Reset(syscall.SIGUSR1, syscall.SIGUSR2)
+	if _, err = d.Install(); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	transitions, done := runDaemon(t, d)
+	waitState(t, transitions, daemon.LifecycleRunning)
+
+	if _, err := d.Pause(); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if status, err := d.StatusInfo(); err != nil || status.State != daemon.StatePaused || d.State() != daemon.LifecyclePaused {
+		t.Errorf("StatusInfo() after Pause() = %s, %v, lifecycle %s", status.State, err, d.State())
+	}
+	if _, err := d.Continue(); err != nil {
+		t.Fatalf("Continue() error = %v", err)
+	}
+	if status, err := d.StatusInfo(); err != nil || status.State != daemon.StateRunning || d.State() != daemon.LifecycleRunning {
+		t.Errorf("StatusInfo() after Continue() = %s, %v, lifecycle %s", status.State, err, d.State())
+	}
+
+	// failed pause handler stops the service
+	pauseErrs <- errors.New("busy")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := d.PauseContext(ctx); err == nil {
+		t.Error("PauseContext() error = nil, want failure of not confirmed pause")
+	}
+	if err := <-done; err == nil || len(stopped) == 0 {
+		t.Errorf("Run() after failed pause = %v, stopped %v, want error and stopped service", err, len(stopped) > 0)
+	}
+}
@@ -4,9 +4,11 @@
 package daemon
 
 import (
-	"html/template"
+	"bytes"
+	"context"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"regexp"
 	"strings"
 )
 
@@ -27,71 +29,134 @@ func (d *daemonUpstart) path() string {
 }
 
 func (d *daemonUpstart) installed() bool {
-	return checkInstalled(d.path())
+	return checkInstalled(d.config.rootPath(d.path()))
 }
 
-func (d *daemonUpstart) running() (string, bool) {
-	return checkRunning(d.config.Name+" start/running", "process ([0-9]+)", "service", d.config.Name, "status")
+func (d *daemonUpstart) backend() string {
+	return string(InitSystemUpstart)
 }
 
-func (d *daemonUpstart) Install(args ...string) error {
-	var (
-		srvPath  = d.path()
-		file     *os.File
-		execPath string
-		templ    *template.Template
-		err      error
-	)
-	file, err = os.Create(srvPath)
+// Job is disabled if its override file contains "manual" stanza
+var upstartManual = regexp.MustCompile(`(?m)^[ \t]*manual[ \t]*$\n?`)
+
+func (d *daemonUpstart) overridePath() string {
+	return "/etc/init/" + d.config.Name + ".override"
+}
+
+func (d *daemonUpstart) enabled() bool {
+	data, err := ioutil.ReadFile(d.config.rootPath(d.overridePath()))
 	if err != nil {
+		return true
+	}
+	return !upstartManual.Match(data)
+}
+
+func (d *daemonUpstart) enable(ctx context.Context) error {
+	var path = d.config.rootPath(d.overridePath())
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
 		return err
 	}
-	defer file.Close()
-	execPath, err = executablePath(d.config.Name)
-	if err != nil {
+	data = upstartManual.ReplaceAll(data, nil)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return os.Remove(path)
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+func (d *daemonUpstart) disable(ctx context.Context) error {
+	var path = d.config.rootPath(d.overridePath())
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	templ, err = template.New("upstart").Parse(d.config.TemplateLinuxUpstart)
+	if upstartManual.Match(data) {
+		return nil
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	return writeFileAtomic(path, append(data, "manual\n"...), 0644)
+}
+
+func (d *daemonUpstart) status(ctx context.Context) ServiceStatus {
+	var status = ServiceStatus{Backend: d.backend(), Enabled: d.enabled()}
+	output, _, err := checkOutput(ctx, d.config, command("service", d.config.Name, "status"))
 	if err != nil {
-		return err
+		return status
 	}
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args, StartRunLevels, StopRunLevels string
-		}{
-			d.config.Name,
-			d.config.Description,
-			execPath,
-			strings.Join(args, " "),
-			strings.Join(d.startRunLevels(), ""),
-			strings.Join(d.stopRunLevels(), ""),
-		},
-	); err != nil {
-		return err
+	job := regexp.MustCompile(regexp.QuoteMeta(d.config.Name) + ` (start|stop)/([a-z-]+)`).FindStringSubmatch(output)
+	if len(job) < 3 {
+		return status
+	}
+	switch {
+	case job[1] == "start" && job[2] == "running":
+		status.State = StateRunning
+		status.PID = matchInt("process ([0-9]+)", output)
+	case job[1] == "start":
+		status.State = StateStarting
+	case job[2] == "waiting":
+		status.State = StateStopped
+	default:
+		status.State = StateStopping
+	}
+	return status
+}
+
+func (d *daemonUpstart) render(args ...string) ([]ServiceFile, error) {
+	execPath, err := executablePath(d.config.Name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := renderTemplate("upstart", d.config.TemplateLinuxUpstart, &struct {
+		Name, Description, Path, Args, StartRunLevels, StopRunLevels string
+	}{
+		d.config.Name,
+		d.config.Description,
+		execPath,
+		strings.Join(args, " "),
+		strings.Join(d.startRunLevels(), ""),
+		strings.Join(d.stopRunLevels(), ""),
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err = os.Chmod(srvPath, 0755); err != nil {
+	return []ServiceFile{{Path: d.path(), Content: content, Mode: 0755}}, nil
+}
+
+func (d *daemonUpstart) Install(ctx context.Context, tx *transaction, args ...string) error {
+	files, err := d.render(args...)
+	if err != nil {
 		return err
 	}
-	return nil
+	return tx.writeServiceFiles(files)
 }
 
-func (d *daemonUpstart) Uninstall() error {
-	return os.Remove(d.path())
+func (d *daemonUpstart) reloadDefinitions(ctx context.Context) (bool, error) {
+	return true, runCommand(ctx, d.config, command("initctl", "reload-configuration"))
+}
+
+func (d *daemonUpstart) Uninstall(ctx context.Context) error {
+	if err := os.Remove(d.config.rootPath(d.overridePath())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(d.config.rootPath(d.path()))
 }
 
-func (d *daemonUpstart) Restart() error {
-	return exec.Command("restart", d.config.Name).Run()
+func (d *daemonUpstart) Restart(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("restart", d.config.Name))
 }
 
-func (d *daemonUpstart) Start() error {
-	return exec.Command("start", d.config.Name).Run()
+func (d *daemonUpstart) Start(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("start", d.config.Name))
 }
 
-func (d *daemonUpstart) Stop() error {
-	return exec.Command("stop", d.config.Name).Run()
+func (d *daemonUpstart) Stop(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("stop", d.config.Name))
 }
 
-func (d *daemonUpstart) Reload() error {
-	return exec.Command("reload", d.config.Name, "reload").Run()
+func (d *daemonUpstart) Reload(ctx context.Context) error {
+	return runCommand(ctx, d.config, command("reload", d.config.Name, "reload"))
 }
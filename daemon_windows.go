@@ -4,7 +4,10 @@
 package daemon
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	runtimeDebug "runtime/debug"
 	"strconv"
 	"syscall"
@@ -12,6 +15,7 @@ import (
 	"unicode/utf16"
 	"unsafe"
 
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/debug"
@@ -37,10 +41,22 @@ func New(c *Config) (Daemon, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.InitSystem != InitSystemAuto && c.InitSystem != InitSystemWindows {
+		return nil, ErrUnsupportedSystem
+	}
 	return &daemon{c}, nil
 }
 
+// DetectInitSystem detects init system of the running host.
+func DetectInitSystem() InitSystemDetection {
+	return InitSystemDetection{InitSystemWindows, "service control manager is the only init system on Windows"}
+}
+
 func (d *daemon) Install(args ...string) (string, error) {
+	return d.InstallContext(context.Background(), args...)
+}
+
+func (d *daemon) InstallContext(ctx context.Context, args ...string) (string, error) {
 	var (
 		action = "Install " + d.config.Description + ":"
 		execp  string
@@ -49,27 +65,40 @@ func (d *daemon) Install(args ...string) (string, error) {
 		err    error
 	)
 	if execp, err = execPath(); err != nil {
-		return failed(action), err // or getWindowsError(err) ?
+		return failed(action), d.error(OpInstall, err)
 	}
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpInstall, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err == nil {
 		w.Close()
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpInstall, ErrAlreadyInstalled)
+	}
+	if err = d.withHooks(ctx, OpInstall, args, func() error {
+		return d.createService(m, execp, args)
+	}, func() error {
+		return deleteService(m, d.config.Name)
+	}); err != nil {
+		return failed(action), d.error(OpInstall, err)
 	}
-	if w, err = m.CreateService(d.config.Name, execp, mgr.Config{
+	return success(action), nil
+}
+
+// Create the service with recovery actions
+func (d *daemon) createService(m *mgr.Mgr, execp string, args []string) error {
+	w, err := m.CreateService(d.config.Name, execp, mgr.Config{
 		DisplayName:      d.config.Name,
 		Description:      d.config.Description,
 		StartType:        d.config.WindowsStartMode,
 		Dependencies:     d.config.Dependencies,
 		ServiceStartName: d.config.WindowsStartAccountName,
 		Password:         d.config.WindowsStartAccountPassword,
-	}, args...); err != nil {
-		return failed(action), getWindowsError(err)
+	}, args...)
+	if err != nil {
+		return err
 	}
 	defer w.Close()
 	// set recovery action for service
@@ -90,13 +119,36 @@ func (d *daemon) Install(args ...string) (string, error) {
 	},
 	}
 	// set reset period as a day
-	if err = w.SetRecoveryActions(r, uint32(86400)); err != nil {
-		return failed(action), getWindowsError(err)
+	return w.SetRecoveryActions(r, uint32(86400))
+}
+
+// Delete the service
+func deleteService(m *mgr.Mgr, name string) error {
+	w, err := m.OpenService(name)
+	if err != nil {
+		return err
 	}
-	return success(action), nil
+	defer w.Close()
+	return w.Delete()
+}
+
+func (d *daemon) Render(args ...string) ([]ServiceFile, error) {
+	return nil, d.error(OpRender, ErrUnsupportedSystem)
+}
+
+func (d *daemon) Upgrade(args ...string) (UpgradeResult, error) {
+	return d.UpgradeContext(context.Background(), args...)
+}
+
+func (d *daemon) UpgradeContext(ctx context.Context, args ...string) (UpgradeResult, error) {
+	return UpgradeResult{}, d.error(OpUpgrade, ErrUnsupportedSystem)
 }
 
 func (d *daemon) Uninstall() (string, error) {
+	return d.UninstallContext(context.Background())
+}
+
+func (d *daemon) UninstallContext(ctx context.Context) (string, error) {
 	var (
 		action = "Uninstalling " + d.config.Description + ":"
 		m      *mgr.Mgr
@@ -104,22 +156,28 @@ func (d *daemon) Uninstall() (string, error) {
 		err    error
 	)
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpUninstall, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpUninstall, err)
 	}
 	defer w.Close()
-	if err = w.Delete(); err != nil {
-		return failed(action), getWindowsError(err)
+	if err = d.withHooks(ctx, OpUninstall, nil, func() error {
+		return w.Delete()
+	}, nil); err != nil {
+		return failed(action), d.error(OpUninstall, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Restart() (string, error) {
+	return d.RestartContext(context.Background())
+}
+
+func (d *daemon) RestartContext(ctx context.Context) (string, error) {
 	var (
 		action = "Restarting " + d.config.Description + ":"
 		m      *mgr.Mgr
@@ -127,25 +185,31 @@ func (d *daemon) Restart() (string, error) {
 		err    error
 	)
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpRestart, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpRestart, err)
 	}
 	defer w.Close()
-	if err = controlService(w, svc.Stop, svc.Stopped, getStopTimeout()); err != nil {
-		return failed(action), getWindowsError(err)
-	}
-	if err = w.Start(); err != nil {
-		return failed(action), getWindowsError(err)
+	if err = d.withHooks(ctx, OpRestart, nil, func() error {
+		if err := controlService(ctx, w, svc.Stop, svc.Stopped, getStopTimeout()); err != nil {
+			return err
+		}
+		return w.Start()
+	}, nil); err != nil {
+		return failed(action), d.error(OpRestart, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Start() (string, error) {
+	return d.StartContext(context.Background())
+}
+
+func (d *daemon) StartContext(ctx context.Context) (string, error) {
 	var (
 		action = "Starting " + d.config.Description + ":"
 		m      *mgr.Mgr
@@ -153,22 +217,30 @@ func (d *daemon) Start() (string, error) {
 		err    error
 	)
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpStart, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpStart, err)
 	}
 	defer w.Close()
-	if err = w.Start(); err != nil {
-		return failed(action), getWindowsError(err)
+	if err = d.withHooks(ctx, OpStart, nil, func() error {
+		return w.Start()
+	}, func() error {
+		return controlService(context.Background(), w, svc.Stop, svc.Stopped, getStopTimeout())
+	}); err != nil {
+		return failed(action), d.error(OpStart, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Stop() (string, error) {
+	return d.StopContext(context.Background())
+}
+
+func (d *daemon) StopContext(ctx context.Context) (string, error) {
 	var (
 		action = "Stopping " + d.config.Description + ":"
 		m      *mgr.Mgr
@@ -176,22 +248,30 @@ func (d *daemon) Stop() (string, error) {
 		err    error
 	)
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpStop, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpStop, err)
 	}
 	defer w.Close()
-	if err = controlService(w, svc.Stop, svc.Stopped, getStopTimeout()); err != nil {
-		return failed(action), getWindowsError(err)
+	if err = d.withHooks(ctx, OpStop, nil, func() error {
+		return controlService(ctx, w, svc.Stop, svc.Stopped, getStopTimeout())
+	}, func() error {
+		return w.Start()
+	}); err != nil {
+		return failed(action), d.error(OpStop, err)
 	}
 	return success(action), nil
 }
 
 func (d *daemon) Status() (string, error) {
+	return d.StatusContext(context.Background())
+}
+
+func (d *daemon) StatusContext(ctx context.Context) (string, error) {
 	var (
 		action = "Getting status " + d.config.Description + ":"
 		m      *mgr.Mgr
@@ -200,26 +280,113 @@ func (d *daemon) Status() (string, error) {
 		err    error
 	)
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpStatus, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpStatus, err)
 	}
 	defer w.Close()
 	if status, err = w.Query(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpStatus, err)
 	}
 	return "Status " + d.config.Description + ":" + getWindowsServiceStateFromUint32(status.State), nil
 }
 
+func (d *daemon) StatusInfo() (ServiceStatus, error) {
+	return d.StatusInfoContext(context.Background())
+}
+
+func (d *daemon) StatusInfoContext(ctx context.Context) (ServiceStatus, error) {
+	var (
+		status = ServiceStatus{Backend: string(InitSystemWindows)}
+		m      *mgr.Mgr
+		w      *mgr.Service
+		query  svc.Status
+		config mgr.Config
+		err    error
+	)
+	if m, err = mgr.Connect(); err != nil {
+		return status, d.error(OpStatus, err)
+	}
+	defer func() {
+		_ = m.Disconnect()
+	}()
+	if w, err = m.OpenService(d.config.Name); err != nil {
+		if err = d.error(OpStatus, err); errors.Is(err, ErrNotInstalled) {
+			status.State = StateNotInstalled
+		}
+		return status, err
+	}
+	defer w.Close()
+	if query, err = w.Query(); err != nil {
+		return status, d.error(OpStatus, err)
+	}
+	if config, err = w.Config(); err != nil {
+		return status, d.error(OpStatus, err)
+	}
+	status.State = getServiceStateFromWindowsState(query.State)
+	status.PID = int(query.ProcessId)
+	status.Enabled = config.StartType == mgr.StartAutomatic
+	return status, nil
+}
+
+func (d *daemon) Ensure(ctx context.Context, state DesiredState) (EnsureResult, error) {
+	return ensure(ctx, d, state)
+}
+
+func (d *daemon) Instance(name string) (Daemon, error) {
+	return nil, ErrUnsupportedSystem
+}
+
+func (d *daemon) enable(ctx context.Context) error {
+	return d.setStartType(OpEnable, mgr.StartAutomatic)
+}
+
+func (d *daemon) disable(ctx context.Context) error {
+	return d.setStartType(OpDisable, mgr.StartManual)
+}
+
+// Set service start type
+func (d *daemon) setStartType(op Operation, startType uint32) error {
+	var (
+		m      *mgr.Mgr
+		w      *mgr.Service
+		config mgr.Config
+		err    error
+	)
+	if m, err = mgr.Connect(); err != nil {
+		return d.error(op, err)
+	}
+	defer func() {
+		_ = m.Disconnect()
+	}()
+	if w, err = m.OpenService(d.config.Name); err != nil {
+		return d.error(op, err)
+	}
+	defer w.Close()
+	if config, err = w.Config(); err != nil {
+		return d.error(op, err)
+	}
+	config.StartType = startType
+	return d.error(op, w.UpdateConfig(config))
+}
+
 func (d *daemon) Reload() (string, error) {
-	return "", ErrUnsupportedSystem
+	return d.ReloadContext(context.Background())
+}
+
+func (d *daemon) ReloadContext(ctx context.Context) (string, error) {
+	return "", d.error(OpReload, ErrUnsupportedSystem)
 }
 
 func (d *daemon) Pause() (string, error) {
+	return d.PauseContext(context.Background())
+}
+
+func (d *daemon) PauseContext(ctx context.Context) (string, error) {
 	var (
 		action = "Pausing " + d.config.Description + ":"
 		m      *mgr.Mgr
@@ -227,21 +394,26 @@ func (d *daemon) Pause() (string, error) {
 		err    error
 	)
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpPause, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpPause, err)
 	}
 	defer w.Close()
-	if err = controlService(w, svc.Pause, svc.Paused, 10*time.Second); err != nil {
-		return failed(action), getWindowsError(err)
+	if err = controlService(ctx, w, svc.Pause, svc.Paused, 10*time.Second); err != nil {
+		return failed(action), d.error(OpPause, err)
 	}
 	return success(action), nil
 }
+
 func (d *daemon) Continue() (string, error) {
+	return d.ContinueContext(context.Background())
+}
+
+func (d *daemon) ContinueContext(ctx context.Context) (string, error) {
 	var (
 		action = "Resuming " + d.config.Description + ":"
 		m      *mgr.Mgr
@@ -249,21 +421,29 @@ func (d *daemon) Continue() (string, error) {
 		err    error
 	)
 	if m, err = mgr.Connect(); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpContinue, err)
 	}
 	defer func() {
 		_ = m.Disconnect()
 	}()
 	if w, err = m.OpenService(d.config.Name); err != nil {
-		return failed(action), getWindowsError(err)
+		return failed(action), d.error(OpContinue, err)
 	}
 	defer w.Close()
-	if err = controlService(w, svc.Continue, svc.Running, 10*time.Second); err != nil {
-		return failed(action), getWindowsError(err)
+	if err = controlService(ctx, w, svc.Continue, svc.Running, 10*time.Second); err != nil {
+		return failed(action), d.error(OpContinue, err)
 	}
 	return success(action), nil
 }
 
+func (d *daemon) State() LifecycleState {
+	return d.config.lifecycle.get()
+}
+
+func (d *daemon) Subscribe(fn func(Transition)) func() {
+	return d.config.lifecycle.subscribe(fn)
+}
+
 // Run - Run service
 func (d *daemon) Run() error {
 	var (
@@ -279,10 +459,43 @@ func (d *daemon) Run() error {
 	if interactive {
 		runit = debug.Run
 	}
-	if err = runit(d.config.Name, &serviceHandler{d.config}); err != nil {
+	hdlr := &serviceHandler{config: d.config}
+	if err = runit(d.config.Name, hdlr); err != nil {
 		return getWindowsError(err)
 	}
-	return nil
+	return hdlr.err
+}
+
+// Run step of the operation between hooks
+func (d *daemon) withHooks(ctx context.Context, op Operation, args []string, fn, undo func() error) error {
+	return d.config.runWithHooks(ctx, HookInfo{
+		Op:      op,
+		Name:    d.config.Name,
+		Backend: string(InitSystemWindows),
+		Path:    d.config.Name,
+		Args:    args,
+	}, fn, undo)
+}
+
+// Wrap error of the operation with backend details. Service manager errors
+// are converted to corresponding package errors where possible.
+func (d *daemon) error(op Operation, err error) error {
+	switch err {
+	case windows.ERROR_SERVICE_DOES_NOT_EXIST:
+		err = ErrNotInstalled
+	case windows.ERROR_SERVICE_EXISTS:
+		err = ErrAlreadyInstalled
+	case windows.ERROR_SERVICE_ALREADY_RUNNING:
+		err = ErrAlreadyRunning
+	case windows.ERROR_SERVICE_NOT_ACTIVE:
+		err = ErrNotStarted
+		if op == OpStop {
+			err = ErrAlreadyStopped
+		}
+	default:
+		err = getWindowsError(err)
+	}
+	return wrapError(op, string(InitSystemWindows), d.config.Name, err)
 }
 
 func execPath() (string, error) {
@@ -302,7 +515,9 @@ func execPath() (string, error) {
 	return string(utf16.Decode(b[0:n])), nil
 }
 
-func controlService(s *mgr.Service, c svc.Cmd, to svc.State, d time.Duration) error {
+// Send control command to the service and poll its state until it becomes
+// the expected one. Polling is bound to ctx and to the timeout d.
+func controlService(ctx context.Context, s *mgr.Service, c svc.Cmd, to svc.State, d time.Duration) error {
 	status, err := s.Control(c)
 	if err != nil {
 		return err
@@ -310,7 +525,8 @@ func controlService(s *mgr.Service, c svc.Cmd, to svc.State, d time.Duration) er
 
 	timeDuration := time.Millisecond * 50
 
-	timeout := time.After(d + timeDuration*2)
+	ctx, cancel := context.WithTimeout(ctx, d+timeDuration*2)
+	defer cancel()
 	tick := time.NewTicker(timeDuration)
 	defer tick.Stop()
 
@@ -321,8 +537,8 @@ func controlService(s *mgr.Service, c svc.Cmd, to svc.State, d time.Duration) er
 			if err != nil {
 				return err
 			}
-		case <-timeout:
-			break
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 	return nil
@@ -366,13 +582,34 @@ func getWindowsServiceStateFromUint32(state svc.State) string {
 	return "SERVICE_UNKNOWN"
 }
 
+func getServiceStateFromWindowsState(state svc.State) ServiceState {
+	switch state {
+	case svc.Stopped:
+		return StateStopped
+	case svc.StartPending, svc.ContinuePending:
+		return StateStarting
+	case svc.StopPending:
+		return StateStopping
+	case svc.Running, svc.PausePending:
+		return StateRunning
+	case svc.Paused:
+		return StatePaused
+	}
+	return StateUnknown
+}
+
 type serviceHandler struct {
 	config *Config
+	// err is an error of the service returned by Run
+	err error
 }
 
 func (hdlr *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
 	var cmdsAccepted = hdlr.config.acceptedCommands()
-	defer hdlr.executeRecover()
+	defer hdlr.executeRecover(&ssec, &errno)
+	if hdlr.config.RunContext != nil {
+		return hdlr.executeContext(r, changes)
+	}
 	changes <- svc.Status{State: svc.StartPending}
 
 	fasttick := time.NewTicker(500 * time.Millisecond)
@@ -380,9 +617,15 @@ func (hdlr *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, c
 	tick := fasttick
 
 	var err error
-	if err = hdlr.config.StartHdlr(); err != nil {
-		return
-	}
+	hdlr.config.lifecycle.set(LifecycleStarting, nil)
+	if err = hdlr.config.callHdlr("start", hdlr.config.StartHdlr, hdlr.config.StartTimeout, nil); err != nil {
+		hdlr.config.logger().Error("start failed", "pid", os.Getpid(), "error", err)
+		err = exitError(ExitCodeStartFailed, err)
+		hdlr.config.fail(err)
+		return hdlr.exit(err)
+	}
+	hdlr.config.logger().Info("service started", "pid", os.Getpid())
+	hdlr.config.lifecycle.set(LifecycleRunning, nil)
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
 loop:
@@ -390,6 +633,15 @@ loop:
 		select {
 		case <-tick.C:
 			break
+		case err = <-hdlr.config.components.failures():
+			hdlr.config.logger().Error("component failed", "pid", os.Getpid(), "error", err)
+			changes <- svc.Status{State: svc.StopPending}
+			hdlr.config.lifecycle.set(LifecycleStopping, nil)
+			if stopErr := hdlr.config.callHdlr("stop", hdlr.config.StopHdlr, hdlr.config.StopTimeout, nil); stopErr != nil {
+				hdlr.config.logger().Error("stop failed", "pid", os.Getpid(), "error", stopErr)
+			}
+			hdlr.config.fail(err)
+			return hdlr.exit(err)
 		case c := <-r:
 			switch c.Cmd {
 			case svc.Interrogate:
@@ -398,34 +650,86 @@ loop:
 				time.Sleep(100 * time.Millisecond)
 				changes <- c.CurrentStatus
 			case svc.Stop, svc.Shutdown:
-				_ = hdlr.config.StopHdlr()
+				hdlr.config.lifecycle.set(LifecycleStopping, nil)
+				if err = hdlr.config.callHdlr("stop", hdlr.config.StopHdlr, hdlr.config.StopTimeout, nil); err != nil {
+					hdlr.config.fail(err)
+				} else {
+					hdlr.config.lifecycle.set(LifecycleStopped, nil)
+				}
 				changes <- svc.Status{State: svc.StopPending}
 				break loop
 			case svc.Pause:
 				err = hdlr.config.PauseHdlr()
 				changes <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
 				tick = slowtick
+				if err == nil {
+					hdlr.config.lifecycle.set(LifecyclePaused, nil)
+				}
 			case svc.Continue:
 				err = hdlr.config.ContinueHdlr()
 				changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 				tick = fasttick
+				if err == nil {
+					hdlr.config.lifecycle.set(LifecycleRunning, nil)
+				}
 			default:
-				hdlr.config.ErrorHdlr("unexpected control request #%d", c)
+				hdlr.config.logger().Warn("unexpected control request", "cmd", c.Cmd)
 				continue loop
 			}
 			if err != nil {
-				return
+				hdlr.config.fail(err)
+				return hdlr.exit(err)
 			}
 		}
 	}
-	return
+	return hdlr.exit(err)
+}
+
+// Run RunContext until it returns or stop request is received
+func (hdlr *serviceHandler) executeContext(r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := hdlr.config.runContext(ctx)
+	changes <- svc.Status{State: svc.Running, Accepts: hdlr.config.acceptedCommands()}
+	for {
+		select {
+		case err := <-done:
+			return hdlr.exit(hdlr.config.finishContext(err))
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				return hdlr.exit(hdlr.config.finishContext(hdlr.config.stopContext(cancel, done, nil)))
+			default:
+				hdlr.config.logger().Warn("unexpected control request", "cmd", c.Cmd)
+			}
+		}
+	}
+}
+
+// Record error of the service returned by Run and report its exit code to
+// the service manager
+func (hdlr *serviceHandler) exit(err error) (bool, uint32) {
+	hdlr.err = err
+	if err == nil {
+		return false, 0
+	}
+	return true, uint32(ExitCode(err))
 }
 
-func (hdlr *serviceHandler) executeRecover() {
+// Recover Execute panic and report it to the service manager with
+// ExitCodePanic through Execute results
+func (hdlr *serviceHandler) executeRecover(ssec *bool, errno *uint32) {
 	str := recover()
 	if str != nil {
 		str = fmt.Sprintf("%s; %s", str, string(runtimeDebug.Stack()))
-		hdlr.config.ErrorHdlr("execute panic: %v", str)
+		hdlr.config.logger().Error("execute panic", "panic", str)
+		err := &ExitError{Code: ExitCodePanic, Err: fmt.Errorf("execute panic: %s", str)}
+		hdlr.config.fail(err)
+		*ssec, *errno = hdlr.exit(err)
 	}
 }
 
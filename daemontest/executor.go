@@ -0,0 +1,111 @@
+/*
+Package daemontest provides fakes for testing code built on package daemon
+without root privileges and a real init system.
+*/
+package daemontest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nsemikov/go-daemon"
+)
+
+// Response is a canned result of a faked command
+type Response struct {
+	// Stdout is returned as command standard output
+	Stdout string
+	// Stderr is returned as command standard error
+	Stderr string
+	// ExitCode is returned as command exit code. Non-zero exit code is
+	// reported as error.
+	ExitCode int
+	// Err is returned as error if not nil
+	Err error
+}
+
+// Executor is a recording fake of daemon.Executor. It does not run
+// anything: every command is recorded and answered with a canned Response.
+type Executor struct {
+	mu        sync.Mutex
+	calls     []daemon.Command
+	prefixes  []string
+	responses map[string]Response
+}
+
+// NewExecutor creates Executor. Commands without canned response succeed
+// with empty output.
+func NewExecutor() *Executor {
+	return &Executor{responses: make(map[string]Response)}
+}
+
+// On sets the response to commands with command line starting with prefix,
+// e.g. "systemctl --no-pager show". The longest matching prefix wins.
+func (e *Executor) On(prefix string, r Response) *Executor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.responses[prefix]; !ok {
+		e.prefixes = append(e.prefixes, prefix)
+	}
+	e.responses[prefix] = r
+	return e
+}
+
+// Execute records the command and returns its canned response.
+func (e *Executor) Execute(ctx context.Context, cmd daemon.Command) (daemon.CommandResult, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, cmd)
+	if err := ctx.Err(); err != nil {
+		return daemon.CommandResult{ExitCode: -1}, err
+	}
+	var (
+		line  = cmd.String()
+		match string
+		r     Response
+	)
+	for _, prefix := range e.prefixes {
+		if strings.HasPrefix(line, prefix) && len(prefix) >= len(match) {
+			match, r = prefix, e.responses[prefix]
+		}
+	}
+	result := daemon.CommandResult{
+		Stdout:   []byte(r.Stdout),
+		Stderr:   []byte(r.Stderr),
+		ExitCode: r.ExitCode,
+	}
+	if r.Err != nil {
+		return result, r.Err
+	}
+	if r.ExitCode != 0 {
+		return result, fmt.Errorf("exit status %d", r.ExitCode)
+	}
+	return result, nil
+}
+
+// Calls returns recorded commands in order of execution.
+func (e *Executor) Calls() []daemon.Command {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]daemon.Command(nil), e.calls...)
+}
+
+// Commands returns command lines of recorded commands in order of execution.
+func (e *Executor) Commands() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	lines := make([]string, 0, len(e.calls))
+	for _, cmd := range e.calls {
+		lines = append(lines, cmd.String())
+	}
+	return lines
+}
+
+// Reset forgets recorded commands. Responses are kept.
+func (e *Executor) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = nil
+}
@@ -0,0 +1,21 @@
+package daemontest
+
+import (
+	"github.com/nsemikov/go-daemon"
+)
+
+// Privileged is a daemon.Config.PrivilegesCheck which allows every
+// operation, so install and start flows can be tested without root.
+func Privileged(op daemon.Operation) error {
+	return nil
+}
+
+// Unprivileged is a daemon.Config.PrivilegesCheck which behaves like a
+// regular user: operations requiring privileges fail with
+// daemon.ErrRootPrivileges.
+func Unprivileged(op daemon.Operation) error {
+	if op.RequiresPrivileges() {
+		return daemon.ErrRootPrivileges
+	}
+	return nil
+}
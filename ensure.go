@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+)
+
+// DesiredState is a target state of the service for Daemon.Ensure
+type DesiredState struct {
+	// Installed is true if the service must be installed
+	Installed bool
+	// Enabled is true if the service must be started at boot
+	Enabled bool
+	// Running is true if the service must be running
+	Running bool
+	// Args are service arguments used if the service is installed
+	Args []string
+}
+
+// EnsureResult reports actions taken by Daemon.Ensure
+type EnsureResult struct {
+	// Actions are performed operations in order of execution
+	Actions []Operation
+}
+
+// Changed reports whether any action was taken.
+func (r EnsureResult) Changed() bool {
+	return len(r.Actions) > 0
+}
+
+// Daemon which can enable and disable service start at boot
+type enabler interface {
+	enable(ctx context.Context) error
+	disable(ctx context.Context) error
+}
+
+// Converge the service to desired state using Daemon methods
+func ensure(ctx context.Context, d Daemon, want DesiredState) (EnsureResult, error) {
+	var result EnsureResult
+	if !want.Installed && (want.Enabled || want.Running) {
+		return result, ErrInvalidDesiredState
+	}
+	step := func(op Operation, fn func() error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+		result.Actions = append(result.Actions, op)
+		return nil
+	}
+	status, err := d.StatusInfoContext(ctx)
+	if err != nil && !errors.Is(err, ErrNotInstalled) {
+		return result, err
+	}
+	if !want.Installed {
+		if status.State == StateNotInstalled {
+			return result, nil
+		}
+		if status.Running() {
+			if err = step(OpStop, func() error {
+				_, err := d.StopContext(ctx)
+				return ignoreError(err, ErrAlreadyStopped)
+			}); err != nil {
+				return result, err
+			}
+		}
+		return result, step(OpUninstall, func() error {
+			_, err := d.UninstallContext(ctx)
+			return ignoreError(err, ErrNotInstalled)
+		})
+	}
+	if status.State == StateNotInstalled {
+		if err = step(OpInstall, func() error {
+			_, err := d.InstallContext(ctx, want.Args...)
+			return ignoreError(err, ErrAlreadyInstalled)
+		}); err != nil {
+			return result, err
+		}
+		if status, err = d.StatusInfoContext(ctx); err != nil {
+			return result, err
+		}
+	}
+	if status.Enabled != want.Enabled {
+		e, ok := d.(enabler)
+		if !ok {
+			return result, ErrUnsupportedSystem
+		}
+		op, fn := OpEnable, e.enable
+		if !want.Enabled {
+			op, fn = OpDisable, e.disable
+		}
+		if err = step(op, func() error {
+			return fn(ctx)
+		}); err != nil {
+			return result, err
+		}
+	}
+	if status.Running() != want.Running {
+		op, fn := OpStart, d.StartContext
+		if !want.Running {
+			op, fn = OpStop, d.StopContext
+		}
+		if err = step(op, func() error {
+			_, err := fn(ctx)
+			return ignoreError(err, ErrAlreadyRunning, ErrAlreadyStopped)
+		}); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Return nil if err is one of expected errors
+func ignoreError(err error, expected ...error) error {
+	for _, target := range expected {
+		if errors.Is(err, target) {
+			return nil
+		}
+	}
+	return err
+}
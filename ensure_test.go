@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Fake Daemon keeping the service state in memory. Methods not used by
+// ensure panic through nil embedded Daemon.
+type ensureDaemon struct {
+	Daemon
+	status ServiceStatus
+}
+
+func (d *ensureDaemon) StatusInfoContext(ctx context.Context) (ServiceStatus, error) {
+	if d.status.State == StateNotInstalled {
+		return d.status, ErrNotInstalled
+	}
+	return d.status, nil
+}
+
+func (d *ensureDaemon) InstallContext(ctx context.Context, args ...string) (string, error) {
+	d.status = ServiceStatus{State: StateStopped, Enabled: true}
+	return "", nil
+}
+
+func (d *ensureDaemon) UninstallContext(ctx context.Context) (string, error) {
+	d.status = ServiceStatus{State: StateNotInstalled}
+	return "", nil
+}
+
+func (d *ensureDaemon) StartContext(ctx context.Context) (string, error) {
+	d.status.State = StateRunning
+	return "", nil
+}
+
+func (d *ensureDaemon) StopContext(ctx context.Context) (string, error) {
+	d.status.State = StateStopped
+	return "", nil
+}
+
+func (d *ensureDaemon) enable(ctx context.Context) error {
+	d.status.Enabled = true
+	return nil
+}
+
+func (d *ensureDaemon) disable(ctx context.Context) error {
+	d.status.Enabled = false
+	return nil
+}
+
+func TestEnsure(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  ServiceStatus
+		want    DesiredState
+		actions []Operation
+		err     error
+	}{
+		{
+			name:    "install enabled and start",
+			status:  ServiceStatus{State: StateNotInstalled},
+			want:    DesiredState{Installed: true, Enabled: true, Running: true},
+			actions: []Operation{OpInstall, OpStart},
+		},
+		{
+			name:    "install disabled",
+			status:  ServiceStatus{State: StateNotInstalled},
+			want:    DesiredState{Installed: true},
+			actions: []Operation{OpInstall, OpDisable},
+		},
+		{
+			name:   "already converged",
+			status: ServiceStatus{State: StateRunning, Enabled: true},
+			want:   DesiredState{Installed: true, Enabled: true, Running: true},
+		},
+		{
+			name:    "enable and stop",
+			status:  ServiceStatus{State: StateRunning},
+			want:    DesiredState{Installed: true, Enabled: true},
+			actions: []Operation{OpEnable, OpStop},
+		},
+		{
+			name:    "stop and uninstall",
+			status:  ServiceStatus{State: StatePaused, Enabled: true},
+			want:    DesiredState{},
+			actions: []Operation{OpStop, OpUninstall},
+		},
+		{
+			name:   "not installed",
+			status: ServiceStatus{State: StateNotInstalled},
+			want:   DesiredState{},
+		},
+		{
+			name:   "running without installation",
+			status: ServiceStatus{State: StateNotInstalled},
+			want:   DesiredState{Running: true},
+			err:    ErrInvalidDesiredState,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &ensureDaemon{status: tt.status}
+			result, err := ensure(context.Background(), d, tt.want)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ensure() error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(result.Actions, tt.actions) {
+				t.Errorf("ensure() actions = %v, want %v", result.Actions, tt.actions)
+			}
+			if err != nil {
+				return
+			}
+			if result, err = ensure(context.Background(), d, tt.want); err != nil || result.Changed() {
+				t.Errorf("second ensure() = %v, %v, want no actions", result.Actions, err)
+			}
+		})
+	}
+}
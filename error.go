@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"errors"
+	"strings"
 )
 
 var (
@@ -37,4 +38,125 @@ var (
 
 	// ErrNotStarted appears if try to reload stopped service
 	ErrNotStarted = errors.New("service is not started")
+
+	// ErrInvalidDesiredState appears if service must be enabled or running
+	// but not installed
+	ErrInvalidDesiredState = errors.New("service can not be enabled or running without installation")
+
+	// ErrCommandFailed appears if init system command exits with failure.
+	// Use errors.As with OperationError to get the command output.
+	ErrCommandFailed = errors.New("init system command failed")
+
+	// ErrHandlerTimeout appears if service handler has not returned in
+	// time, see Config.StopTimeout
+	ErrHandlerTimeout = errors.New("service handler timed out")
+
+	// ErrComponentDependency appears if components have unknown, duplicate
+	// or cyclic dependencies
+	ErrComponentDependency = errors.New("invalid component dependencies")
+
+	// ErrComponentsWithRunContext appears if both components and RunContext
+	// are specified in service config
+	ErrComponentsWithRunContext = errors.New("components can not be used with RunContext")
+
+	// ErrComponentsWithHandlers appears if components are specified along
+	// with StartHdlr, StopHdlr or ReloadHdlr which New sets to manage them
+	ErrComponentsWithHandlers = errors.New("components can not be used with service handlers")
+
+	// ErrPauseNotConfirmed appears if the running service has not marked
+	// itself paused or continued, e.g. its runtime directory is not
+	// writable
+	ErrPauseNotConfirmed = errors.New("service has not confirmed pause or continue")
+
+	// ErrNotTemplateUnit appears if instance is requested for service which
+	// is not a template unit
+	ErrNotTemplateUnit = errors.New("service is not a template unit")
+
+	// ErrInvalidInstanceName appears if instance name is empty, too long or
+	// contains characters other than ASCII letters, digits, ":", "-", "_"
+	// and "."
+	ErrInvalidInstanceName = errors.New("invalid instance name")
 )
+
+// OperationError records failed Daemon operation with the backend (init
+// system) details. Err is one of the errors above or the underlying cause,
+// so errors.Is(err, ErrNotInstalled) works through it.
+type OperationError struct {
+	// Op is a failed operation
+	Op Operation
+	// Backend is a name of the init system, e.g. "systemd"
+	Backend string
+	// Path is a path to service file or unit
+	Path string
+	// Command is a command line of failed init system command, if any
+	Command []string
+	// ExitCode is an exit code of failed command
+	ExitCode int
+	// Stdout is captured standard output of failed command
+	Stdout string
+	// Stderr is captured standard error of failed command
+	Stderr string
+	// Err is the cause
+	Err error
+}
+
+// Output returns the init system message: stderr of failed command or its
+// stdout if stderr is empty.
+func (e *OperationError) Output() string {
+	if out := strings.TrimSpace(e.Stderr); out != "" {
+		return out
+	}
+	return strings.TrimSpace(e.Stdout)
+}
+
+func (e *OperationError) Error() string {
+	var b strings.Builder
+	b.WriteString(string(e.Op))
+	if e.Backend != "" {
+		b.WriteString(" [" + e.Backend + "]")
+	}
+	if e.Path != "" {
+		b.WriteString(" " + e.Path)
+	}
+	if len(e.Command) > 0 {
+		b.WriteString(": " + strings.Join(e.Command, " "))
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	if out := e.Output(); out != "" {
+		b.WriteString(": " + out)
+	}
+	return b.String()
+}
+
+// Unwrap returns the cause.
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports ErrCommandFailed for failed init system commands.
+func (e *OperationError) Is(target error) bool {
+	return target == ErrCommandFailed && len(e.Command) > 0
+}
+
+// Wrap error into OperationError, filling missing operation details
+func wrapError(op Operation, backend, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	opErr, ok := err.(*OperationError)
+	if !ok {
+		return &OperationError{Op: op, Backend: backend, Path: path, Err: err}
+	}
+	if opErr.Op == "" {
+		opErr.Op = op
+	}
+	if opErr.Backend == "" {
+		opErr.Backend = backend
+	}
+	if opErr.Path == "" {
+		opErr.Path = path
+	}
+	return opErr
+}
@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWrapError(t *testing.T) {
+	if err := wrapError(OpStart, "systemd", "/etc/svc", nil); err != nil {
+		t.Fatalf("wrapError(nil) = %v, want nil", err)
+	}
+	err := wrapError(OpStart, "systemd", "/etc/svc", ErrNotInstalled)
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.Op != OpStart || opErr.Backend != "systemd" || opErr.Path != "/etc/svc" {
+		t.Fatalf("wrapError() = %#v, want OperationError with details", err)
+	}
+	if !errors.Is(err, ErrNotInstalled) || errors.Is(err, ErrCommandFailed) {
+		t.Errorf("wrapError() = %v, want ErrNotInstalled only", err)
+	}
+	// operation of inner error is kept, missing details are filled
+	inner := &OperationError{Op: OpRender, Err: ErrAlreadyInstalled}
+	err = wrapError(OpInstall, "sysv", "/etc/init.d/svc", inner)
+	if err != inner || inner.Op != OpRender || inner.Backend != "sysv" || inner.Path != "/etc/init.d/svc" {
+		t.Errorf("wrapError() = %#v, want filled inner error", err)
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	err := &OperationError{
+		Op:       OpStart,
+		Backend:  "systemd",
+		Command:  []string{"systemctl", "start", "svc.service"},
+		ExitCode: 5,
+		Stdout:   "ignored",
+		Stderr:   "Unit svc.service not found.\n",
+		Err:      errors.New("exit status 5"),
+	}
+	if !errors.Is(err, ErrCommandFailed) {
+		t.Error("errors.Is(err, ErrCommandFailed) = false, want true for failed command")
+	}
+	if got := err.Output(); got != "Unit svc.service not found." {
+		t.Errorf("Output() = %q, want stderr", got)
+	}
+	want := "start [systemd]: systemctl start svc.service: exit status 5: Unit svc.service not found."
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -18,6 +18,11 @@ func getWindowsError(inputError error) error {
 			}
 		}
 	}
+	if errno, ok := inputError.(syscall.Errno); ok {
+		if sysErr, ok := WinErrCode[int(errno)]; ok {
+			return fmt.Errorf("\n %s: %s \n %s", sysErr.Title, sysErr.Description, sysErr.Action)
+		}
+	}
 
 	return inputError
 }
@@ -45,6 +45,22 @@ func newService() *service {
 	return s
 }
 
+// printServiceFiles prints service files which install would create
+func printServiceFiles(d daemon.Daemon, args ...string) error {
+	files, err := d.Render(args...)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Mode&os.ModeSymlink != 0 {
+			fmt.Printf("# %s -> %s\n", file.Path, file.Target)
+			continue
+		}
+		fmt.Printf("# %s (%v)\n%s\n", file.Path, file.Mode, file.Content)
+	}
+	return nil
+}
+
 func main() {
 	s := newService()
 	d, err := daemon.New(daemon.NewConfig(
@@ -60,14 +76,30 @@ func main() {
 	}
 
 	var (
-		usage  = "Usage: " + os.Args[0] + " install | uninstall | restart | start | stop | status"
+		usage  = "Usage: " + os.Args[0] + " install [--dry-run] | upgrade | uninstall | restart | start | stop | status"
 		status string
 	)
 	if len(os.Args) > 1 {
 		command := os.Args[1]
+		dryRun := len(os.Args) > 2 && os.Args[2] == "--dry-run"
+		if daemon.Operation(command).RequiresPrivileges() && !dryRun {
+			// re-run the command with sudo if needed
+			if err = daemon.Elevate(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
 		switch command {
 		case "install":
+			if dryRun {
+				err = printServiceFiles(d, os.Args[3:]...)
+				break
+			}
 			status, err = d.Install(os.Args[2:]...)
+		case "upgrade":
+			var result daemon.UpgradeResult
+			result, err = d.Upgrade(os.Args[2:]...)
+			status = result.String()
 		case "uninstall":
 			status, err = d.Uninstall()
 		case "restart":
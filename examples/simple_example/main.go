@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"html"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/nsemikov/go-daemon"
@@ -43,14 +42,9 @@ func main() {
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	d, _ := daemon.New(daemon.NewConfig(
+	daemon.RunAndExit(daemon.NewConfig(
 		daemon.WithStartHdlr(s.Start),
 		daemon.WithStopHdlr(s.Stop),
 		daemon.WithHideMethodsWarning(true),
 	))
-
-	if err := d.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
-	}
 }
@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Command is an external command run by Daemon, e.g. systemctl.
+type Command struct {
+	// Name is a name or path of the program
+	Name string
+	// Args are command arguments
+	Args []string
+	// Env is an additional environment in "KEY=value" form
+	Env []string
+}
+
+// String returns command line.
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// CommandResult is a result of executed Command
+type CommandResult struct {
+	// Stdout is captured standard output
+	Stdout []byte
+	// Stderr is captured standard error
+	Stderr []byte
+	// ExitCode is an exit code of the command, -1 if it was not run
+	ExitCode int
+}
+
+// Executor runs external commands for Daemon. Set it with WithExecutor to
+// fake the init system in tests, see daemontest package.
+type Executor interface {
+	// Execute runs the command and returns its result. Error must be
+	// non-nil if the command was not run or exits with non-zero code.
+	Execute(ctx context.Context, cmd Command) (CommandResult, error)
+}
+
+// Default Executor running commands with os/exec
+var defaultExecutor Executor = execExecutor{}
+
+type execExecutor struct{}
+
+func (execExecutor) Execute(ctx context.Context, cmd Command) (CommandResult, error) {
+	var (
+		stdout, stderr bytes.Buffer
+		result         = CommandResult{ExitCode: -1}
+		c              = exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	)
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	c.Stdout, c.Stderr = &stdout, &stderr
+	err := c.Run()
+	if c.ProcessState != nil {
+		result.ExitCode = c.ProcessState.ExitCode()
+	}
+	result.Stdout, result.Stderr = stdout.Bytes(), stderr.Bytes()
+	return result, err
+}
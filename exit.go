@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of the service process. The codes follow sysexits.h where it
+// is possible, so init systems and operators can tell failures apart.
+const (
+	// ExitCodeOK is an exit code of cleanly stopped service
+	ExitCodeOK = 0
+	// ExitCodeFailure is an exit code of the service failed while running
+	// or stopping
+	ExitCodeFailure = 1
+	// ExitCodeReloadFailed is an exit code of the service failed to reload
+	// (EX_DATAERR)
+	ExitCodeReloadFailed = 65
+	// ExitCodeStartFailed is an exit code of the service failed to start
+	// (EX_UNAVAILABLE)
+	ExitCodeStartFailed = 69
+	// ExitCodePanic is an exit code of the service handler panic
+	// (EX_SOFTWARE)
+	ExitCodePanic = 70
+	// ExitCodeHandlerTimeout is an exit code of the process if StartHdlr,
+	// StopHdlr or ReloadHdlr has not returned in time (EX_TEMPFAIL)
+	ExitCodeHandlerTimeout = 75
+	// ExitCodeConfig is an exit code of invalid service configuration, the
+	// service is not restarted by systemd (EX_CONFIG)
+	ExitCodeConfig = 78
+	// ExitCodeForcedShutdown is an exit code of the process terminated by
+	// the second signal while StopHdlr is running, systemd treats it as
+	// success
+	ExitCodeForcedShutdown = 130
+)
+
+// nolint:gochecknoglobals
+var (
+	// Exit codes written to SuccessExitStatus of systemd unit
+	successExitCodes = []int{ExitCodeForcedShutdown}
+	// Exit codes written to RestartPreventExitStatus of systemd unit
+	restartPreventExitCodes = []int{ExitCodeConfig}
+)
+
+// ExitError is an error returned by Run with the exit code of the process.
+// Use ExitCode to get the code of any error.
+type ExitError struct {
+	// Code is an exit code of the process, one of ExitCode constants
+	Code int
+	// Err is the cause
+	Err error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return "exit status " + strconv.Itoa(e.Code)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the cause.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns exit code of the process for error returned by Run:
+// ExitCodeOK for nil, code of ExitError or ExitCodeFailure otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitCodeFailure
+}
+
+// RunAndExit creates daemon with the config, runs it and exits the process
+// with ExitCode of the result.
+func RunAndExit(cfg *Config) {
+	d, err := New(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(ExitCodeConfig)
+		return
+	}
+	exit(ExitCode(d.Run()))
+}
+
+// Wrap error into ExitError with code unless it already has one
+func exitError(code int, err error) error {
+	var exitErr *ExitError
+	if err == nil || errors.As(err, &exitErr) {
+		return err
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// Join exit codes for systemd unit
+func joinExitCodes(codes []int) string {
+	list := make([]string, 0, len(codes))
+	for _, code := range codes {
+		list = append(list, strconv.Itoa(code))
+	}
+	return strings.Join(list, " ")
+}
@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	cause := errors.New("cause")
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"nil", nil, ExitCodeOK},
+		{"plain error", cause, ExitCodeFailure},
+		{"exit error", &ExitError{Code: ExitCodeStartFailed, Err: cause}, ExitCodeStartFailed},
+		{"wrapped exit error", fmt.Errorf("run: %w", &ExitError{Code: ExitCodePanic}), ExitCodePanic},
+		{"exitError", exitError(ExitCodeReloadFailed, cause), ExitCodeReloadFailed},
+		{"exitError keeps code", exitError(ExitCodeReloadFailed, &ExitError{Code: ExitCodeHandlerTimeout}), ExitCodeHandlerTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := ExitCode(tt.err); code != tt.code {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, code, tt.code)
+			}
+		})
+	}
+	if err := exitError(ExitCodeFailure, nil); err != nil {
+		t.Errorf("exitError(nil) = %v, want nil", err)
+	}
+	if err := exitError(ExitCodeStartFailed, cause); !errors.Is(err, cause) || err.Error() != "cause" {
+		t.Errorf("exitError() = %v, want error wrapping cause", err)
+	}
+}
+
+func TestRunAndExitConfig(t *testing.T) {
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	stderr := os.Stderr
+	os.Stderr, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stderr = stderr }()
+
+	RunAndExit(nil)
+	if code != ExitCodeConfig {
+		t.Errorf("RunAndExit(nil) exit code = %d, want %d", code, ExitCodeConfig)
+	}
+}
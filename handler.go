@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// Terminate the process, replaced in tests
+var exit = os.Exit
+
+// Call service handler. If the handler has not returned in timeout (zero
+// means no timeout) or a stop signal is received from interrupt, the handler
+// is considered hung: goroutine stacks are dumped to stderr and the process
+// exits. Other signals from interrupt are handled while waiting.
+func (c *Config) callHdlr(name string, hdlr func() error, timeout time.Duration, interrupt <-chan os.Signal) error {
+	var (
+		done    = goHdlr(name, hdlr)
+		expired <-chan time.Time
+	)
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-expired:
+			c.logger().Error("handler timed out", "handler", name, "timeout", timeout, "pid", os.Getpid())
+			c.abort(ExitCodeHandlerTimeout)
+			return ErrHandlerTimeout
+		case sig := <-interrupt:
+			if action, _ := c.signalAction(sig); !action.is(SignalStop) {
+				c.runSignalAction(sig, action)
+				continue
+			}
+			c.logger().Error("signal received while handler is running, forcing exit",
+				"handler", name, "signal", sig.String(), "pid", os.Getpid())
+			c.abort(ExitCodeForcedShutdown)
+			return ErrHandlerTimeout
+		}
+	}
+}
+
+// Run handler in goroutine. Result of the handler or its panic is sent to
+// the returned channel.
+func goHdlr(name string, hdlr func() error) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- safeCall(name, hdlr)
+	}()
+	return done
+}
+
+// Call handler, its panic is returned as error
+func safeCall(name string, hdlr func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &ExitError{
+				Code: ExitCodePanic,
+				Err:  fmt.Errorf("%s handler panic: %v; %s", name, r, debug.Stack()),
+			}
+		}
+	}()
+	return hdlr()
+}
+
+// Start RunContext in goroutine, its result is sent to the returned channel
+func (c *Config) runContext(ctx context.Context) <-chan error {
+	c.lifecycle.set(LifecycleStarting, nil)
+	done := goHdlr("run", func() error { return c.supervise(ctx, "run", c.RunContext) })
+	c.logger().Info("service started", "pid", os.Getpid())
+	c.lifecycle.set(LifecycleRunning, nil)
+	return done
+}
+
+// Cancel ctx of RunContext and wait until it returns. The wait is limited
+// with StopTimeout and interrupted by a signal from interrupt as for
+// StopHdlr. Cancellation error of RunContext is not a failure.
+func (c *Config) stopContext(cancel context.CancelFunc, done <-chan error, interrupt <-chan os.Signal) error {
+	c.lifecycle.set(LifecycleStopping, nil)
+	cancel()
+	err := c.callHdlr("run", func() error { return <-done }, c.StopTimeout, interrupt)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// Record result of RunContext
+func (c *Config) finishContext(err error) error {
+	if err != nil {
+		c.logger().Error("run failed", "pid", os.Getpid(), "error", err)
+		c.fail(err)
+		return err
+	}
+	c.lifecycle.set(LifecycleStopped, nil)
+	return nil
+}
+
+// Dump goroutine stacks and exit with code
+func (c *Config) abort(code int) {
+	c.fail(&ExitError{Code: code, Err: ErrHandlerTimeout})
+	fmt.Fprintf(os.Stderr, "%s\n", allStacks())
+	exit(code)
+}
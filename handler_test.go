@@ -0,0 +1,33 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCallHdlrTimeout(t *testing.T) {
+	var code int
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	c := NewConfig(WithLogger(nopLogger{}))
+	block := make(chan struct{})
+	defer close(block)
+	err := c.callHdlr("stop", func() error { <-block; return nil }, 10*time.Millisecond, nil)
+	if !errors.Is(err, ErrHandlerTimeout) || code != ExitCodeHandlerTimeout {
+		t.Errorf("callHdlr() = %v, exit code %d, want ErrHandlerTimeout, %d", err, code, ExitCodeHandlerTimeout)
+	}
+	if state := c.lifecycle.get(); state != LifecycleFailed {
+		t.Errorf("state = %v, want %v", state, LifecycleFailed)
+	}
+}
+
+func TestCallHdlrPanic(t *testing.T) {
+	c := NewConfig(WithLogger(nopLogger{}))
+	err := c.callHdlr("start", func() error { panic("boom") }, 0, nil)
+	if code := ExitCode(err); code != ExitCodePanic {
+		t.Errorf("ExitCode(callHdlr()) = %d, want %d", code, ExitCodePanic)
+	}
+}
@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+)
+
+// Hook is a user step run before or after Daemon operation, e.g. creating
+// directories on install or printing instructions after it. Set hooks with
+// WithPreHook and WithPostHook.
+type Hook func(ctx context.Context, info HookInfo) error
+
+// HookInfo describes the operation the hook is run for
+type HookInfo struct {
+	// Op is the operation
+	Op Operation
+	// Name is the service name
+	Name string
+	// Backend is a name of the init system, e.g. "systemd"
+	Backend string
+	// Path is a path to service file or unit
+	Path string
+	// Args are service arguments of Install
+	Args []string
+}
+
+// Run fn between pre and post hooks of the operation. Pre hook error aborts
+// the operation. Post hook error reverts the operation with undo, if it is
+// not nil.
+func (c *Config) runWithHooks(ctx context.Context, info HookInfo, fn, undo func() error) error {
+	for _, hook := range c.PreHooks[info.Op] {
+		if err := hook(ctx, info); err != nil {
+			return fmt.Errorf("pre-%s hook: %w", info.Op, err)
+		}
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	for _, hook := range c.PostHooks[info.Op] {
+		if err := hook(ctx, info); err != nil {
+			if undo != nil {
+				if undoErr := undo(); undoErr != nil {
+					c.logger().Error("rollback failed", "op", info.Op, "backend", info.Backend, "error", undoErr)
+				}
+			}
+			return fmt.Errorf("post-%s hook: %w", info.Op, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRunWithHooks(t *testing.T) {
+	var calls []string
+	hook := func(name string, err error) Hook {
+		return func(ctx context.Context, info HookInfo) error {
+			calls = append(calls, name+" "+string(info.Op))
+			return err
+		}
+	}
+	step := func(name string, err error) func() error {
+		return func() error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	failure := errors.New("failure")
+	tests := []struct {
+		name  string
+		pre   []Hook
+		post  []Hook
+		fn    error
+		calls []string
+		err   bool
+	}{
+		{
+			name:  "success",
+			pre:   []Hook{hook("pre1", nil), hook("pre2", nil)},
+			post:  []Hook{hook("post1", nil), hook("post2", nil)},
+			calls: []string{"pre1 start", "pre2 start", "fn", "post1 start", "post2 start"},
+		},
+		{
+			name:  "pre hook fails",
+			pre:   []Hook{hook("pre1", failure), hook("pre2", nil)},
+			post:  []Hook{hook("post1", nil)},
+			calls: []string{"pre1 start"},
+			err:   true,
+		},
+		{
+			name:  "operation fails",
+			post:  []Hook{hook("post1", nil)},
+			fn:    failure,
+			calls: []string{"fn"},
+			err:   true,
+		},
+		{
+			name:  "post hook fails",
+			post:  []Hook{hook("post1", failure), hook("post2", nil)},
+			calls: []string{"fn", "post1 start", "undo"},
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			c := NewConfig(
+				WithLogger(nopLogger{}),
+				func(c *Config) {
+					c.PreHooks = map[Operation][]Hook{OpStart: tt.pre}
+					c.PostHooks = map[Operation][]Hook{OpStart: tt.post}
+				},
+			)
+			err := c.runWithHooks(context.Background(), HookInfo{Op: OpStart}, step("fn", tt.fn), step("undo", nil))
+			if (err != nil) != tt.err || tt.err && !errors.Is(err, failure) {
+				t.Errorf("runWithHooks() error = %v, want failure %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("runWithHooks() calls = %q, want %q", calls, tt.calls)
+			}
+		})
+	}
+}
+
+// Logger dropping all messages
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
@@ -0,0 +1,25 @@
+package daemon
+
+// InitSystem is a name of the init system (service manager) used by Daemon
+type InitSystem string
+
+// Supported init systems.
+const (
+	// InitSystemAuto selects init system with DetectInitSystem
+	InitSystemAuto    InitSystem = ""
+	InitSystemSystemD InitSystem = "systemd"
+	InitSystemUpstart InitSystem = "upstart"
+	InitSystemSystemV InitSystem = "sysv"
+	InitSystemLaunchd InitSystem = "launchd"
+	InitSystemRCD     InitSystem = "rc.d"
+	InitSystemWindows InitSystem = "windows"
+)
+
+// InitSystemDetection is a result of DetectInitSystem
+type InitSystemDetection struct {
+	// System is the detected init system
+	System InitSystem
+	// Evidence describes why the System was chosen,
+	// e.g. "/run/systemd/system exists"
+	Evidence string
+}
@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+)
+
+// LifecycleState is a state of the service process driven by Daemon.Run
+type LifecycleState int
+
+const (
+	// LifecycleIdle appears before Run or if custom RunHdlr is used
+	LifecycleIdle LifecycleState = iota
+	// LifecycleStarting appears while StartHdlr is running
+	LifecycleStarting
+	// LifecycleRunning appears after successful start
+	LifecycleRunning
+	// LifecycleReloading appears while ReloadHdlr is running
+	LifecycleReloading
+	// LifecyclePaused appears after successful PauseHdlr
+	LifecyclePaused
+	// LifecycleStopping appears while StopHdlr is running
+	LifecycleStopping
+	// LifecycleStopped appears after successful stop
+	LifecycleStopped
+	// LifecycleFailed appears if a handler fails
+	LifecycleFailed
+)
+
+// String returns the name of the state.
+func (s LifecycleState) String() string {
+	switch s {
+	case LifecycleIdle:
+		return "idle"
+	case LifecycleStarting:
+		return "starting"
+	case LifecycleRunning:
+		return "running"
+	case LifecycleReloading:
+		return "reloading"
+	case LifecyclePaused:
+		return "paused"
+	case LifecycleStopping:
+		return "stopping"
+	case LifecycleStopped:
+		return "stopped"
+	case LifecycleFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Transition is a change of the lifecycle state
+type Transition struct {
+	// From is the previous state
+	From LifecycleState
+	// To is the new state
+	To LifecycleState
+	// Err is the handler error for LifecycleFailed
+	Err error
+	// Time of the transition
+	Time time.Time
+}
+
+// Lifecycle state of the process with subscribers notified on transitions.
+// Nil lifecycle stays idle.
+type lifecycle struct {
+	mu          sync.Mutex
+	state       LifecycleState
+	subscribers map[int]func(Transition)
+	nextID      int
+}
+
+func (l *lifecycle) get() LifecycleState {
+	if l == nil {
+		return LifecycleIdle
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// Change the state and notify subscribers. Subscribers are called in the
+// goroutine of the run loop, outside of the lock.
+func (l *lifecycle) set(to LifecycleState, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	t := Transition{From: l.state, To: to, Err: err, Time: time.Now()}
+	l.state = to
+	subscribers := make([]func(Transition), 0, len(l.subscribers))
+	for _, fn := range l.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	l.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(t)
+	}
+}
+
+func (l *lifecycle) subscribe(fn func(Transition)) func() {
+	if l == nil {
+		return func() {}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscribers == nil {
+		l.subscribers = make(map[int]func(Transition))
+	}
+	id := l.nextID
+	l.nextID++
+	l.subscribers[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers, id)
+	}
+}
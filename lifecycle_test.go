@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLifecycleSubscribe(t *testing.T) {
+	var (
+		l      lifecycle
+		got    []Transition
+		failed = errors.New("failed")
+	)
+	unsubscribe := l.subscribe(func(tr Transition) {
+		got = append(got, tr)
+	})
+	l.set(LifecycleStarting, nil)
+	l.set(LifecycleFailed, failed)
+	unsubscribe()
+	l.set(LifecycleStopped, nil)
+	if len(got) != 2 {
+		t.Fatalf("subscriber got %d transitions, want 2: %+v", len(got), got)
+	}
+	if got[0].From != LifecycleIdle || got[0].To != LifecycleStarting || got[0].Time.IsZero() {
+		t.Errorf("transition = %+v, want idle -> starting", got[0])
+	}
+	if got[1].From != LifecycleStarting || got[1].To != LifecycleFailed || got[1].Err != failed {
+		t.Errorf("transition = %+v, want starting -> failed with error", got[1])
+	}
+	if state := l.get(); state != LifecycleStopped {
+		t.Errorf("get() = %s, want stopped", state)
+	}
+
+	// nil lifecycle of custom RunHdlr stays idle
+	var nilLifecycle *lifecycle
+	nilLifecycle.subscribe(func(Transition) { t.Error("nil lifecycle notified subscriber") })()
+	nilLifecycle.set(LifecycleRunning, nil)
+	if state := nilLifecycle.get(); state != LifecycleIdle {
+		t.Errorf("get() of nil lifecycle = %s, want idle", state)
+	}
+}
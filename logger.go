@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logger is a leveled structured logger used for every message of the
+// package. Args are key-value pairs of attributes, e.g.
+// "op", OpInstall, "backend", "systemd". *slog.Logger satisfies Logger,
+// see WithSlog.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Get configured Logger or Logger writing to ErrorHdlr and InfoHdlr
+func (c *Config) logger() Logger {
+	if c.Logger == nil {
+		return hdlrLogger{c}
+	}
+	return c.Logger
+}
+
+// Logger adapter for printf-style handlers. Debug messages are dropped,
+// warnings and errors are written to ErrorHdlr.
+type hdlrLogger struct {
+	config *Config
+}
+
+func (l hdlrLogger) Debug(msg string, args ...interface{}) {}
+
+func (l hdlrLogger) Info(msg string, args ...interface{}) {
+	l.config.InfoHdlr("%s", formatRecord(msg, args))
+}
+
+func (l hdlrLogger) Warn(msg string, args ...interface{}) {
+	l.config.ErrorHdlr("%s", formatRecord(msg, args))
+}
+
+func (l hdlrLogger) Error(msg string, args ...interface{}) {
+	l.config.ErrorHdlr("%s", formatRecord(msg, args))
+}
+
+// Format message with attributes as "msg key=value ..."
+func formatRecord(msg string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	return b.String()
+}
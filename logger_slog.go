@@ -0,0 +1,21 @@
+//go:build go1.21
+// +build go1.21
+
+package daemon
+
+import (
+	"log/slog"
+)
+
+var _ Logger = (*slog.Logger)(nil)
+
+// WithSlog sets slog logger as Config.Logger, slog.Default() is used if
+// logger is nil.
+func WithSlog(logger *slog.Logger) ConfigOption {
+	return func(c *Config) {
+		if logger == nil {
+			logger = slog.Default()
+		}
+		c.Logger = logger
+	}
+}
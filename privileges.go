@@ -0,0 +1,45 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Check rights to perform the operation on system service. Process is
+// privileged if its effective user is root or it has capabilities to manage
+// services.
+func checkPrivileges(c *Config, op Operation) error {
+	if c.PrivilegesCheck != nil {
+		return c.PrivilegesCheck(op)
+	}
+	if !op.RequiresPrivileges() || os.Geteuid() == 0 || hasCapabilities() {
+		return nil
+	}
+	return ErrRootPrivileges
+}
+
+// Elevate re-executes the current command with root privileges through
+// sudo or pkexec if the process is not privileged. On success Elevate does
+// not return as the process is replaced; it returns nil if the process is
+// already privileged.
+func Elevate() error {
+	if os.Geteuid() == 0 || hasCapabilities() {
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	for _, tool := range []string{"sudo", "pkexec"} {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			continue
+		}
+		return syscall.Exec(path, append([]string{tool, exe}, os.Args[1:]...), os.Environ())
+	}
+	return ErrRootPrivileges
+}
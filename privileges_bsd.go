@@ -0,0 +1,9 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package daemon
+
+// Capabilities are not supported, only root is privileged
+func hasCapabilities() bool {
+	return false
+}
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Capabilities required to manage services without root: write service
+// files owned by root and control the service manager.
+const (
+	capDACOverride = 1
+	capSysAdmin    = 21
+)
+
+// Check effective capabilities of the process
+func hasCapabilities() bool {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return false
+		}
+		var required uint64 = 1<<capDACOverride | 1<<capSysAdmin
+		return caps&required == required
+	}
+	return false
+}
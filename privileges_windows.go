@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package daemon
+
+// Elevate does nothing on Windows: run the command as administrator, the
+// service control manager denies access otherwise.
+func Elevate() error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package daemon
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+)
+
+// ServiceFile is a service definition file generated by Daemon.Render
+type ServiceFile struct {
+	// Path is an absolute path of the file on the target system, RootDir
+	// is not included
+	Path string
+	// Content of the file, empty for symlinks
+	Content []byte
+	// Mode of the file, os.ModeSymlink is set for symlinks
+	Mode os.FileMode
+	// Target of the symlink
+	Target string
+}
+
+// Execute service template with data
+func renderTemplate(name, text string, data interface{}) ([]byte, error) {
+	templ, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = templ.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
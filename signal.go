@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+)
+
+// SignalAction is an action of the run loop on a signal, one of the
+// built-in actions or custom callback created with SignalFunc. Set it with
+// WithSignalAction.
+type SignalAction struct {
+	name string
+	fn   func() error
+}
+
+// nolint:gochecknoglobals
+var (
+	// SignalStop stops the service with StopHdlr
+	SignalStop = SignalAction{name: "stop"}
+	// SignalReload reloads the service with ReloadHdlr
+	SignalReload = SignalAction{name: "reload"}
+	// SignalPause pauses the service with PauseHdlr
+	SignalPause = SignalAction{name: "pause"}
+	// SignalContinue continues paused service with ContinueHdlr
+	SignalContinue = SignalAction{name: "continue"}
+	// SignalIgnore ignores the signal
+	SignalIgnore = SignalAction{name: "ignore"}
+	// SignalDumpStacks writes stacks of all goroutines to stderr and keeps
+	// the service running
+	SignalDumpStacks = SignalAction{name: "dump stacks"}
+)
+
+// SignalFunc creates custom signal action. Error of fn is logged and the
+// service keeps running.
+func SignalFunc(name string, fn func() error) SignalAction {
+	return SignalAction{name: name, fn: fn}
+}
+
+func (a SignalAction) String() string {
+	return a.name
+}
+
+// Check action is the built-in one
+func (a SignalAction) is(builtin SignalAction) bool {
+	return a.fn == nil && a.name == builtin.name
+}
+
+// Get action of the signal: configured one or the default
+func (c *Config) signalAction(sig os.Signal) (SignalAction, bool) {
+	if action, ok := c.SignalActions[sig]; ok {
+		return action, true
+	}
+	action, ok := c.defaultSignalActions()[sig]
+	return action, ok
+}
+
+// Get actions of all handled signals
+func (c *Config) signalActions() map[os.Signal]SignalAction {
+	actions := c.defaultSignalActions()
+	for sig, action := range c.SignalActions {
+		actions[sig] = action
+	}
+	return actions
+}
+
+// Run action which keeps the service running: dump stacks or custom
+// callback
+func (c *Config) runSignalAction(sig os.Signal, action SignalAction) {
+	switch {
+	case action.fn != nil:
+		if err := safeCall(action.name, action.fn); err != nil {
+			c.logger().Error("signal action failed", "signal", sig.String(), "action", action.name, "error", err)
+		}
+	case action.is(SignalDumpStacks):
+		fmt.Fprintf(os.Stderr, "%s\n", allStacks())
+	}
+}
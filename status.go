@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	statusNotInstalled = "Service not installed"
+)
+
+// ServiceState is a state of the service as reported by the init system
+type ServiceState int
+
+const (
+	// StateUnknown appears if the state can not be determined
+	StateUnknown ServiceState = iota
+	// StateNotInstalled appears if the service is not installed
+	StateNotInstalled
+	// StateStopped appears if the service is installed but not running
+	StateStopped
+	// StateStarting appears if the service is starting
+	StateStarting
+	// StateRunning appears if the service is running
+	StateRunning
+	// StateReloading appears if the service is reloading its configuration
+	StateReloading
+	// StateStopping appears if the service is stopping
+	StateStopping
+	// StatePaused appears if the service is paused
+	StatePaused
+	// StateFailed appears if the service has exited with failure
+	StateFailed
+)
+
+// String returns the name of the state.
+func (s ServiceState) String() string {
+	switch s {
+	case StateNotInstalled:
+		return "not-installed"
+	case StateStopped:
+		return "stopped"
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateReloading:
+		return "reloading"
+	case StateStopping:
+		return "stopping"
+	case StatePaused:
+		return "paused"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// ServiceStatus is a structured status of the service
+type ServiceStatus struct {
+	// State of the service
+	State ServiceState
+	// PID is a main process identifier, 0 if unknown or not running
+	PID int
+	// Enabled reports whether the service is started at boot
+	Enabled bool
+	// ActiveSince is a time the service entered the running state,
+	// zero if unknown or not running
+	ActiveSince time.Time
+	// ExitCode is the last exit code of the main process, if known
+	ExitCode int
+	// Backend is a name of the init system managing the service
+	Backend string
+	// Properties are raw machine-readable properties reported by the
+	// backend, e.g. ActiveState and SubState for systemd. Nil if the backend
+	// has no such properties.
+	Properties map[string]string
+}
+
+// Running reports whether the service process is alive: running, reloading
+// or paused.
+func (s ServiceStatus) Running() bool {
+	switch s.State {
+	case StateRunning, StateReloading, StatePaused:
+		return true
+	}
+	return false
+}
+
+// String returns human readable status, as returned by Daemon.Status.
+func (s ServiceStatus) String() string {
+	var pid string
+	if s.PID > 0 {
+		pid = "(pid  " + strconv.Itoa(s.PID) + ") "
+	}
+	switch s.State {
+	case StateNotInstalled:
+		return statusNotInstalled
+	case StateStarting:
+		return "Service " + pid + "is starting..."
+	case StateRunning:
+		return "Service " + pid + "is running..."
+	case StateReloading:
+		return "Service " + pid + "is reloading..."
+	case StateStopping:
+		return "Service " + pid + "is stopping..."
+	case StatePaused:
+		return "Service " + pid + "is paused"
+	case StateFailed:
+		return "Service has failed (exit code " + strconv.Itoa(s.ExitCode) + ")"
+	}
+	return "Service is stopped"
+}
@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RestartPolicy configures in-process supervisor of RunContext and of
+// component RunContext. Failed (returned error or panicked) function is
+// restarted with exponential backoff until MaxRestarts restarts happen
+// within Window, then the failure is returned and the process exits.
+// Zero fields are replaced with defaults.
+type RestartPolicy struct {
+	// InitialBackoff is a delay before the first restart, 100ms by default
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay, 30s by default
+	MaxBackoff time.Duration
+	// Multiplier of the delay for every next restart within Window, 2 by
+	// default
+	Multiplier float64
+	// Jitter is a fraction of the delay added or subtracted randomly, e.g.
+	// 0.2 means ±20%. Zero means no jitter.
+	Jitter float64
+	// MaxRestarts is a restart budget per Window, 5 by default
+	MaxRestarts int
+	// Window is a period of the restart budget, 1 minute by default
+	Window time.Duration
+}
+
+// Restart history of the supervised function
+type restarter struct {
+	policy   RestartPolicy
+	restarts []time.Time
+	// rand is a jitter source, global one is not seeded before Go 1.20
+	rand *rand.Rand
+}
+
+func newRestarter(policy RestartPolicy) *restarter {
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 30 * time.Second
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+	if policy.MaxRestarts <= 0 {
+		policy.MaxRestarts = 5
+	}
+	if policy.Window <= 0 {
+		policy.Window = time.Minute
+	}
+	return &restarter{policy: policy, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Return delay before the next restart or false if restart budget is
+// exhausted
+func (r *restarter) next(now time.Time) (time.Duration, bool) {
+	recent := r.restarts[:0]
+	for _, t := range r.restarts {
+		if now.Sub(t) < r.policy.Window {
+			recent = append(recent, t)
+		}
+	}
+	r.restarts = recent
+	if len(r.restarts) >= r.policy.MaxRestarts {
+		return 0, false
+	}
+	delay := float64(r.policy.InitialBackoff)
+	for i := 0; i < len(r.restarts) && delay < float64(r.policy.MaxBackoff); i++ {
+		delay *= r.policy.Multiplier
+	}
+	if delay > float64(r.policy.MaxBackoff) {
+		delay = float64(r.policy.MaxBackoff)
+	}
+	if r.policy.Jitter > 0 {
+		delay += delay * r.policy.Jitter * (2*r.rand.Float64() - 1)
+	}
+	r.restarts = append(r.restarts, now)
+	return time.Duration(delay), true
+}
+
+// Run fn until it succeeds or ctx is cancelled, restarting it on failure
+// according to RestartPolicy. Without RestartPolicy fn is run once.
+func (c *Config) supervise(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	var r *restarter
+	if c.RestartPolicy != nil {
+		r = newRestarter(*c.RestartPolicy)
+	}
+	for {
+		err := safeCall(name, func() error { return fn(ctx) })
+		if err == nil || ctx.Err() != nil || r == nil {
+			return err
+		}
+		delay, ok := r.next(time.Now())
+		if !ok {
+			return fmt.Errorf("%s: restart budget exhausted: %w", name, err)
+		}
+		c.logger().Warn("restarting failed handler", "handler", name, "error", err, "backoff", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
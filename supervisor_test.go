@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestarterNext(t *testing.T) {
+	r := newRestarter(RestartPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     500 * time.Millisecond,
+		MaxRestarts:    5,
+		Window:         time.Minute,
+	})
+	now := time.Now()
+	for i, want := range []time.Duration{100, 200, 400, 500, 500} {
+		delay, ok := r.next(now)
+		if !ok || delay != want*time.Millisecond {
+			t.Fatalf("next() #%d = %v, %v, want %v, true", i, delay, ok, want*time.Millisecond)
+		}
+	}
+	if _, ok := r.next(now); ok {
+		t.Fatal("next() after MaxRestarts restarts = true, want exhausted budget")
+	}
+	// restarts out of window are forgotten, backoff starts over
+	if delay, ok := r.next(now.Add(time.Minute)); !ok || delay != 100*time.Millisecond {
+		t.Fatalf("next() after window = %v, %v, want 100ms, true", delay, ok)
+	}
+}
+
+func TestRestarterJitter(t *testing.T) {
+	r := newRestarter(RestartPolicy{InitialBackoff: time.Second, Jitter: 0.2, MaxRestarts: 100})
+	now := time.Now()
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		r.restarts = nil
+		delay, ok := r.next(now)
+		if !ok || delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("next() = %v, %v, want 1s±20%%", delay, ok)
+		}
+		seen[delay] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("next() returned the same delay %d times, want jitter", 10)
+	}
+}
@@ -53,17 +53,25 @@ run_rc_command "$1"
 
 	// nolint:gochecknoglobals
 	defaultTemplateLinuxSystemD = `[Unit]
-Description={{.Description}}
+Description={{.Description}}{{if .Instance}} {{.Instance}}{{end}}
 Requires={{.Dependencies}}
 After={{.Dependencies}}
 [Service]
 ExecStart={{.Path}} {{.Args}}
 ExecReload=kill -HUP $MAINPID
 Restart=on-failure
+SuccessExitStatus={{.SuccessExitStatus}}
+RestartPreventExitStatus={{.RestartPreventExitStatus}}
 [Install]
-WantedBy=multi-user.target
+WantedBy={{.WantedBy}}
 `
 
+	// nolint:gochecknoglobals
+	defaultTemplateLinuxSystemDInstance = `[Service]
+{{if .Args}}ExecStart=
+ExecStart={{.Path}} {{.Args}}
+{{end}}`
+
 	// nolint:gochecknoglobals
 	defaultTemplateLinuxSystemV = `#! /bin/sh
 #
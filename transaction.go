@@ -0,0 +1,154 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package daemon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Undo log of the performed install steps. On failure the steps are rolled
+// back in reverse order.
+type transaction struct {
+	config *Config
+	undo   []func() error
+}
+
+// Record the step undo function
+func (tx *transaction) add(undo func() error) {
+	tx.undo = append(tx.undo, undo)
+}
+
+// Undo performed steps. Rollback continues on errors, they are logged.
+func (tx *transaction) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i](); err != nil {
+			tx.config.logger().Error("rollback failed", "error", err)
+		}
+	}
+	tx.undo = nil
+}
+
+// Write rendered service files under RootDir. Symlinks to run level
+// directories which do not exist are skipped, as not every system has them.
+func (tx *transaction) writeServiceFiles(files []ServiceFile) error {
+	for _, file := range files {
+		path := tx.config.rootPath(file.Path)
+		if file.Mode&os.ModeSymlink != 0 {
+			if !checkInstalled(filepath.Dir(path)) {
+				continue
+			}
+			if err := os.Symlink(file.Target, path); err != nil {
+				return err
+			}
+		} else if err := writeFileAtomic(path, file.Content, file.Mode.Perm()); err != nil {
+			return err
+		}
+		tx.add(func() error {
+			return os.Remove(path)
+		})
+	}
+	return nil
+}
+
+// Update service files under RootDir which differ from rendered ones.
+// Returns paths of changed files.
+func (tx *transaction) updateServiceFiles(files []ServiceFile) ([]string, error) {
+	var changed []string
+	for _, file := range files {
+		path := tx.config.rootPath(file.Path)
+		if file.Mode&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err == nil && target == file.Target {
+				continue
+			}
+			// not every system has all run level directories
+			if !checkInstalled(filepath.Dir(path)) {
+				continue
+			}
+			if err = symlinkAtomic(file.Target, path); err != nil {
+				return changed, err
+			}
+			tx.add(func() error {
+				if target == "" {
+					return os.Remove(path)
+				}
+				return symlinkAtomic(target, path)
+			})
+			changed = append(changed, file.Path)
+			continue
+		}
+		info, statErr := os.Stat(path)
+		content, readErr := ioutil.ReadFile(path)
+		if statErr == nil && readErr == nil &&
+			info.Mode().Perm() == file.Mode.Perm() && bytes.Equal(content, file.Content) {
+			continue
+		}
+		if err := writeFileAtomic(path, file.Content, file.Mode.Perm()); err != nil {
+			return changed, err
+		}
+		tx.add(func() error {
+			if statErr != nil || readErr != nil {
+				return os.Remove(path)
+			}
+			return writeFileAtomic(path, content, info.Mode().Perm())
+		})
+		changed = append(changed, file.Path)
+	}
+	return changed, nil
+}
+
+// Write file via temporary file in the same directory, so readers see
+// either old or new content
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// Replace symlink via temporary symlink in the same directory
+func symlinkAtomic(target, path string) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Flush directory entries to disk
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
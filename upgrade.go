@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"strings"
+)
+
+// UpgradeResult reports changes made by Daemon.Upgrade
+type UpgradeResult struct {
+	// Installed is true if the service was not installed, so Upgrade
+	// installed it
+	Installed bool
+	// Changed are paths of service files written by Upgrade
+	Changed []string
+	// Reloaded is true if the init system reloaded service definitions
+	Reloaded bool
+	// Restarted is true if the running service was restarted
+	Restarted bool
+}
+
+// String returns human readable summary of the changes.
+func (r UpgradeResult) String() string {
+	switch {
+	case r.Installed:
+		return "Service installed"
+	case len(r.Changed) == 0:
+		return "Service is up to date"
+	}
+	msg := "Service files updated: " + strings.Join(r.Changed, ", ")
+	if r.Reloaded {
+		msg += "; definitions reloaded"
+	}
+	if r.Restarted {
+		msg += "; service restarted"
+	}
+	return msg
+}
@@ -4,6 +4,8 @@
 package daemon
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"regexp"
@@ -11,10 +13,6 @@ import (
 	"strings"
 )
 
-const (
-	statusNotInstalled = "Service not installed"
-)
-
 // Show colored "OK"
 func success(msg string) string {
 	return msg + "\t\t\t\t\t[  \033[32mOK\033[0m  ]"
@@ -25,39 +23,71 @@ func failed(msg string) string {
 	return msg + "\t\t\t\t\t[\033[31mFAILED\033[0m]"
 }
 
-// Check root rights to use system service
-func checkPrivileges() (bool, error) {
-	if output, err := exec.Command("id", "-g").Output(); err == nil {
-		if gid, parseErr := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 32); parseErr == nil {
-			if gid == 0 {
-				return true, nil
-			}
-			return false, ErrRootPrivileges
-		}
-	}
-	return false, ErrUnsupportedSystem
-}
-
 // Check service running or not
 func checkInstalled(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
-// Check service running or not
-func checkRunning(matchRegexStr, pidRegexStr string, cmd string, args ...string) (string, bool) {
-	output, err := exec.Command(cmd, args...).Output()
-	if err == nil {
-		if matched, err := regexp.MatchString(matchRegexStr, string(output)); err == nil && matched {
-			reg := regexp.MustCompile(pidRegexStr)
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
-			}
-			return "Service is running...", true
+// Prepare command
+func command(name string, args ...string) Command {
+	return Command{Name: name, Args: args}
+}
+
+// Run command with configured Executor. Failure is reported as
+// OperationError with command line, exit code and output filled in. Command
+// killed on ctx cancellation is reported with ctx error.
+func runCommand(ctx context.Context, c *Config, cmd Command) error {
+	result, err := c.executor().Execute(ctx, cmd)
+	c.logger().Debug("command executed", "command", cmd.String(), "exit_code", result.ExitCode)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return &OperationError{
+			Command:  append([]string{cmd.Name}, cmd.Args...),
+			ExitCode: result.ExitCode,
+			Stdout:   string(result.Stdout),
+			Stderr:   string(result.Stderr),
+			Err:      err,
 		}
 	}
-	return "Service is stopped", false
+	return nil
+}
+
+// Run command with configured Executor and return its output and exit code.
+// Non-zero exit code is not an error: status commands use it to report the
+// service state.
+func checkOutput(ctx context.Context, c *Config, cmd Command) (string, int, error) {
+	result, err := c.executor().Execute(ctx, cmd)
+	c.logger().Debug("command executed", "command", cmd.String(), "exit_code", result.ExitCode)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", -1, ctxErr
+	}
+	if result.ExitCode > 0 {
+		return string(result.Stdout), result.ExitCode, nil
+	}
+	return string(result.Stdout), 0, err
+}
+
+// Find first submatch of regex in output and parse it as integer
+func matchInt(regexStr, output string) int {
+	data := regexp.MustCompile(regexStr).FindStringSubmatch(output)
+	if len(data) < 2 {
+		return 0
+	}
+	value, _ := strconv.Atoi(data[1])
+	return value
+}
+
+// Read pid from pid file
+func readPIDFile(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
 }
 
 // Lookup path for executable file